@@ -0,0 +1,224 @@
+// Package acl holds the users allowed to use a node and what each of them
+// may do: which commands they can run and which keys they can touch.
+//
+// Users are loaded from a JSON file:
+//
+//	{"users": [
+//	  {"name": "admin", "password": "$2a$10$...", "commands": ["*"], "keys": ["*"]},
+//	  {"name": "app", "password": "$2a$10$...", "commands": ["@read", "@write"], "keys": ["user:*", "session:*"]}
+//	]}
+//
+// Passwords are bcrypt hashes (see HashPassword). Commands are command
+// names, categories (@read, @write, @pubsub, @admin) or * for all of them.
+// Keys are key names or prefixes ending in *; * alone is every key.
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned for an unknown user or a wrong password
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// DefaultUser is the user AUTH with only a password logs in as
+const DefaultUser = "default"
+
+// categories groups commands so rules don't have to list each one
+var categories = map[string][]string{
+	"@read": {"GET", "TYPE", "HGET", "HGETALL", "LRANGE", "LLEN",
+		"ZSCORE", "ZRANK", "ZRANGE", "ZRANGEBYSCORE"},
+	"@write": {"SET", "DEL", "DELETE", "HSET", "HDEL", "HINCRBY",
+		"LPUSH", "RPUSH", "LPOP", "RPOP", "BLPOP", "BRPOP",
+		"ZADD", "ZREM", "ZINCRBY"},
+	"@pubsub": {"SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PUBLISH",
+		"WATCHKEYS", "UNWATCHKEYS"},
+	"@admin": {"SYNC", "STATS", "INFO", "SLOWLOG", "MONITOR", "UNMONITOR", "CLIENT", "CDC", "ACL"},
+}
+
+// User is one entry of the registry
+type User struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password,omitempty"` // bcrypt hash
+	Commands []string `json:"commands"`
+	Keys     []string `json:"keys"`
+
+	allowed map[string]bool // expanded Commands
+}
+
+// Registry is the set of users of a node. It is safe for concurrent use.
+type Registry struct {
+	users map[string]*User
+
+	// Successful logins, so that clients that authenticate on every request
+	// (HTTP, gRPC) don't pay for bcrypt each time
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+// maxVerified bounds the cache of successful logins
+const maxVerified = 1024
+
+// Load reads a registry from a JSON file
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Users []User `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("acl: %s: %w", path, err)
+	}
+	return New(file.Users)
+}
+
+// New builds a registry, checking every user
+func New(users []User) (*Registry, error) {
+	r := &Registry{
+		users:    make(map[string]*User, len(users)),
+		verified: make(map[[sha256.Size]byte]bool),
+	}
+	for i := range users {
+		u := users[i]
+		if u.Name == "" {
+			return nil, fmt.Errorf("acl: user %d has no name", i+1)
+		}
+		if _, ok := r.users[u.Name]; ok {
+			return nil, fmt.Errorf("acl: user %q is defined twice", u.Name)
+		}
+		if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+			return nil, fmt.Errorf("acl: user %q: password must be a bcrypt hash", u.Name)
+		}
+
+		u.allowed = make(map[string]bool)
+		for _, rule := range u.Commands {
+			rule = strings.ToUpper(rule)
+			switch {
+			case rule == "*":
+				u.allowed["*"] = true
+			case strings.HasPrefix(rule, "@"):
+				cmds, ok := categories[strings.ToLower(rule)]
+				if !ok {
+					return nil, fmt.Errorf("acl: user %q: unknown category %s", u.Name, strings.ToLower(rule))
+				}
+				for _, cmd := range cmds {
+					u.allowed[cmd] = true
+				}
+			default:
+				u.allowed[rule] = true
+			}
+		}
+		r.users[u.Name] = &u
+	}
+	return r, nil
+}
+
+// HashPassword returns the bcrypt hash to store in the users file
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Authenticate checks a user's password
+func (r *Registry) Authenticate(name, password string) (*User, error) {
+	u, ok := r.users[name]
+	if !ok {
+		// Take as long as a wrong password would, so names can't be probed
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	sum := sha256.Sum256([]byte(name + "\x00" + password + "\x00" + u.Password))
+	r.mu.Lock()
+	cached := r.verified[sum]
+	r.mu.Unlock()
+	if cached {
+		return u, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	r.mu.Lock()
+	if len(r.verified) >= maxVerified {
+		clear(r.verified)
+	}
+	r.verified[sum] = true
+	r.mu.Unlock()
+	return u, nil
+}
+
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("simple-kv"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Users lists the users by name, without their password hashes
+func (r *Registry) Users() []User {
+	users := make([]User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, User{Name: u.Name, Commands: u.Commands, Keys: u.Keys})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// CanRun reports whether the user may run cmd
+func (u *User) CanRun(cmd string) bool {
+	return u.allowed["*"] || u.allowed[strings.ToUpper(cmd)]
+}
+
+// CanAccess reports whether the user may touch key
+func (u *User) CanAccess(key string) bool {
+	for _, p := range u.Keys {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessPattern reports whether every key matching a glob pattern (as
+// taken by WATCHKEYS) is one the user may touch. Only the literal prefix
+// of the pattern is looked at, so the answer errs on the side of no.
+func (u *User) CanAccessPattern(pattern string) bool {
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = pattern[:i]
+	} else {
+		return u.CanAccess(pattern)
+	}
+
+	for _, p := range u.Keys {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(literal, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessAll reports whether the user may touch every key
+func (u *User) CanAccessAll() bool {
+	for _, p := range u.Keys {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
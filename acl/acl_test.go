@@ -0,0 +1,89 @@
+package acl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func hash(t *testing.T, password string) string {
+	t.Helper()
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(h)
+}
+
+func TestRegistryRules(t *testing.T) {
+	r, err := New([]User{
+		{Name: "admin", Password: hash(t, "secret"), Commands: []string{"*"}, Keys: []string{"*"}},
+		{Name: "app", Password: hash(t, "app-pass"), Commands: []string{"@read", "set"}, Keys: []string{"user:*", "config"}},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, err := r.Authenticate("app", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a wrong password to fail, got %v", err)
+	}
+	if _, err := r.Authenticate("nobody", "app-pass"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected an unknown user to fail, got %v", err)
+	}
+	app, err := r.Authenticate("app", "app-pass")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	// The second login is served from the cache
+	if again, err := r.Authenticate("app", "app-pass"); err != nil || again != app {
+		t.Errorf("Expected a repeated login to succeed, got %v", err)
+	}
+
+	for cmd, want := range map[string]bool{"GET": true, "hgetall": true, "SET": true, "DEL": false, "SYNC": false} {
+		if app.CanRun(cmd) != want {
+			t.Errorf("CanRun(%s) = %v, want %v", cmd, !want, want)
+		}
+	}
+	for key, want := range map[string]bool{"user:1": true, "user:": true, "users": false, "config": true, "config:x": false} {
+		if app.CanAccess(key) != want {
+			t.Errorf("CanAccess(%s) = %v, want %v", key, !want, want)
+		}
+	}
+	for pattern, want := range map[string]bool{"user:*": true, "user:1?": true, "u*": false, "*": false, "config": true} {
+		if app.CanAccessPattern(pattern) != want {
+			t.Errorf("CanAccessPattern(%s) = %v, want %v", pattern, !want, want)
+		}
+	}
+	if app.CanAccessAll() {
+		t.Error("Expected app not to access every key")
+	}
+
+	admin, _ := r.Authenticate("admin", "secret")
+	if !admin.CanRun("SYNC") || !admin.CanAccessAll() {
+		t.Error("Expected admin to be allowed everything")
+	}
+
+	users := r.Users()
+	if len(users) != 2 || users[0].Name != "admin" || users[0].Password != "" {
+		t.Errorf("Unexpected user list: %+v", users)
+	}
+}
+
+func TestLoadRejectsBadUsers(t *testing.T) {
+	for name, users := range map[string]string{
+		"plain password":   `{"users": [{"name": "a", "password": "secret"}]}`,
+		"missing name":     `{"users": [{"password": "` + hash(t, "x") + `"}]}`,
+		"unknown category": `{"users": [{"name": "a", "password": "` + hash(t, "x") + `", "commands": ["@everything"]}]}`,
+		"duplicate user": `{"users": [{"name": "a", "password": "` + hash(t, "x") + `"},
+			{"name": "a", "password": "` + hash(t, "x") + `"}]}`,
+	} {
+		path := filepath.Join(t.TempDir(), "users.json")
+		os.WriteFile(path, []byte(users), 0o600)
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected Load to fail", name)
+		}
+	}
+}
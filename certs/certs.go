@@ -0,0 +1,161 @@
+// Package certs loads TLS certificates from disk for the client listener
+// and for connections between peers. Files are checked again on every new
+// connection, at most once per CheckInterval, so certificates can be rotated
+// by replacing the files without restarting the node.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CheckInterval is how often the files are checked for changes
+const CheckInterval = time.Second
+
+// Reloader holds a certificate, its key and optionally a CA bundle, and
+// reloads them when the files change
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool // nil without a CA file
+	modTime time.Time      // newest modification time of the files loaded
+	checked time.Time
+}
+
+// New loads certFile and keyFile and, when caFile is not empty, the CA
+// bundle used to verify the other end. With a CA, the listener asks clients
+// for a certificate and peers use it to verify each other (mutual TLS).
+func New(certFile, keyFile, caFile string) (*Reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("certs: both a certificate and a key file are needed")
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. On error the previous certificates stay in
+// use.
+func (r *Reloader) Reload() error {
+	modTime, err := r.newestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("certs: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("certs: no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.modTime = &cert, pool, modTime
+	r.checked = time.Now()
+	return nil
+}
+
+// Mutual reports whether a CA was given, so both ends present certificates
+func (r *Reloader) Mutual() bool {
+	_, pool := r.current()
+	return pool != nil
+}
+
+// ServerConfig returns a config for a listener. Clients may present a
+// certificate; when they do it must be signed by the CA.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if pool != nil {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig returns a config for dialling serverName, presenting the
+// current certificate and verifying the server against the CA (or the
+// system roots without one)
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	cert, pool := r.current()
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		ServerName:   serverName,
+		Certificates: []tls.Certificate{*cert},
+		RootCAs:      pool,
+	}
+}
+
+// current - the loaded certificates, reloading them first if the files
+// have changed since
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	due := time.Since(r.checked) >= CheckInterval
+	if due {
+		r.checked = time.Now()
+	}
+	loaded := r.modTime
+	r.mu.Unlock()
+
+	if due {
+		if modTime, err := r.newestModTime(); err == nil && modTime.After(loaded) {
+			if err := r.Reload(); err != nil {
+				slog.Warn("reloading certificates failed, keeping the old ones", "err", err)
+			} else {
+				slog.Info("reloaded certificates")
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.pool
+}
+
+func (r *Reloader) newestModTime() (time.Time, error) {
+	var newest time.Time
+	for _, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("certs: %w", err)
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	return newest, nil
+}
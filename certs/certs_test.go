@@ -0,0 +1,59 @@
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/internal/testcerts"
+)
+
+func TestReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := testcerts.Write(t, dir)
+
+	r, err := New(files.Cert, files.Key, files.CA)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if !r.Mutual() {
+		t.Error("Expected a CA to enable mutual TLS")
+	}
+	first := r.ClientConfig("localhost").Certificates[0].Certificate[0]
+
+	// Rotate the certificates, making sure the files look newer
+	testcerts.Write(t, dir)
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{files.CA, files.Cert, files.Key} {
+		os.Chtimes(name, later, later)
+	}
+
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+
+	second := r.ClientConfig("localhost").Certificates[0].Certificate[0]
+	if string(first) == string(second) {
+		t.Error("Expected the rotated certificate to be picked up")
+	}
+
+	// A broken file keeps the current certificate in use
+	os.WriteFile(files.Cert, []byte("not a certificate"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Error("Expected reloading a broken certificate to fail")
+	}
+	if got := r.ClientConfig("localhost").Certificates[0].Certificate[0]; string(got) != string(second) {
+		t.Error("Expected the previous certificate to stay in use")
+	}
+}
+
+func TestNewFailsOnMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := New(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), ""); err == nil {
+		t.Error("Expected missing files to fail")
+	}
+	if _, err := New("", "", ""); err == nil {
+		t.Error("Expected an error without certificate files")
+	}
+}
@@ -0,0 +1,470 @@
+// Package client is the Go client for simple-kv. It keeps a pool of
+// connections, fails over across a list of node addresses and turns the
+// server's framed replies (HELLO 2) into values and typed errors.
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrNotFound is returned when a key does not exist
+	ErrNotFound = errors.New("simple-kv: key not found")
+	// ErrWrongType is returned when a key holds a different kind of value
+	ErrWrongType = errors.New("simple-kv: wrong type")
+	// ErrClosed is returned when the client has been closed
+	ErrClosed = errors.New("simple-kv: client closed")
+	// ErrNoNodes is returned when no node address was given
+	ErrNoNodes = errors.New("simple-kv: no node addresses")
+)
+
+// ServerError is an error reply from the server, such as ERR_SYNTAX or
+// ERR_UNKNOWN_COMMAND. These are never retried.
+type ServerError struct {
+	Code string
+	Msg  string
+}
+
+func (e *ServerError) Error() string {
+	if e.Code == "" {
+		return "simple-kv: " + e.Msg
+	}
+	return fmt.Sprintf("simple-kv: %s %s", e.Code, e.Msg)
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithPoolSize sets how many idle connections are kept per client
+func WithPoolSize(n int) Option {
+	return func(c *Client) { c.poolSize = n }
+}
+
+// WithRetries sets how many times a command is retried on another node
+// after a network error
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = n }
+}
+
+// WithDialTimeout sets the timeout for connecting to a node
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) { c.dialTimeout = d }
+}
+
+// WithTLS connects to the nodes over TLS. When cfg has no ServerName, the
+// host of each node address is used.
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Client) { c.tls = cfg }
+}
+
+// WithAuth logs every connection in as user (see AUTH on the server)
+func WithAuth(user, password string) Option {
+	return func(c *Client) { c.user, c.password = user, password }
+}
+
+// Client talks to a simple-kv cluster. It is safe for concurrent use.
+type Client struct {
+	addrs       []string
+	poolSize    int
+	retries     int
+	dialTimeout time.Duration
+	tls         *tls.Config
+	user        string
+	password    string
+
+	mu     sync.Mutex
+	idle   []*conn
+	next   int // index of the node new connections go to
+	closed bool
+}
+
+// conn is a pooled connection to one node
+type conn struct {
+	net.Conn
+	addr   string
+	reader *bufio.Reader
+}
+
+// New creates a client for the nodes at addrs. Connections are opened
+// lazily, so New does not fail when nodes are down.
+func New(addrs []string, opts ...Option) (*Client, error) {
+	if len(addrs) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	c := &Client{
+		addrs:       append([]string(nil), addrs...),
+		poolSize:    8,
+		retries:     len(addrs),
+		dialTimeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Close closes every idle connection. Connections in use are closed when
+// they are returned.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// Get returns the value of key, or ErrNotFound
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	if err := checkArgs(key); err != nil {
+		return "", err
+	}
+	replies, err := c.do(ctx, []string{"GET " + key})
+	if err != nil {
+		return "", err
+	}
+	return parseGet(replies[0])
+}
+
+// Set stores value at key
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	if err := checkArgs(key, value); err != nil {
+		return err
+	}
+	replies, err := c.do(ctx, []string{fmt.Sprintf("SET %s %s", key, value)})
+	if err != nil {
+		return err
+	}
+	return expect(replies[0], "OK")
+}
+
+// Del deletes key. Deleting a missing key is not an error.
+func (c *Client) Del(ctx context.Context, key string) error {
+	if err := checkArgs(key); err != nil {
+		return err
+	}
+	replies, err := c.do(ctx, []string{"DEL " + key})
+	if err != nil {
+		return err
+	}
+	return expect(replies[0], "DELETED")
+}
+
+// Ping checks that a node answers
+func (c *Client) Ping(ctx context.Context) error {
+	replies, err := c.do(ctx, []string{"PING"})
+	if err != nil {
+		return err
+	}
+	return expect(replies[0], "PONG")
+}
+
+// MGet returns the values of all keys that exist. The GETs are pipelined
+// on a single connection.
+func (c *Client) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	if err := checkArgs(keys...); err != nil {
+		return nil, err
+	}
+	cmds := make([]string, len(keys))
+	for i, key := range keys {
+		cmds[i] = "GET " + key
+	}
+
+	replies, err := c.do(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(keys))
+	for i, reply := range replies {
+		value, err := parseGet(reply)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[keys[i]] = value
+	}
+	return values, nil
+}
+
+// Stats returns the statistics of whichever node served the request
+func (c *Client) Stats(ctx context.Context) (map[string]interface{}, error) {
+	replies, err := c.do(ctx, []string{"STATS"})
+	if err != nil {
+		return nil, err
+	}
+
+	value, _, err := parseReply(replies[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var stats map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &stats); err != nil {
+		return nil, &ServerError{Msg: "malformed stats: " + value}
+	}
+	return stats, nil
+}
+
+// Info returns the INFO sections of whichever node served the request,
+// keyed by section name; no sections means all of them
+func (c *Client) Info(ctx context.Context, sections ...string) (map[string]map[string]interface{}, error) {
+	replies, err := c.do(ctx, []string{strings.Join(append([]string{"INFO"}, sections...), " ")})
+	if err != nil {
+		return nil, err
+	}
+
+	value, _, err := parseReply(replies[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var info map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &info); err != nil {
+		return nil, &ServerError{Msg: "malformed info: " + value}
+	}
+	return info, nil
+}
+
+// do sends cmds on one connection and reads one reply per command. Network
+// errors move on to the next node until the retries run out.
+func (c *Client) do(ctx context.Context, cmds []string) ([]string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		cn, err := c.get(ctx)
+		if err != nil {
+			lastErr = err
+			var serverErr *ServerError
+			if errors.Is(err, ErrClosed) || errors.As(err, &serverErr) {
+				return nil, err
+			}
+			continue
+		}
+
+		replies, err := cn.roundTrip(ctx, cmds)
+		if err != nil {
+			cn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			c.failover(cn.addr)
+			lastErr = err
+			continue
+		}
+
+		c.put(cn)
+		return replies, nil
+	}
+	return nil, lastErr
+}
+
+// get returns an idle connection or dials the current node
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	addr := c.addrs[c.next]
+	c.mu.Unlock()
+
+	d := net.Dialer{Timeout: c.dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err == nil && c.tls != nil {
+		nc, err = handshake(ctx, nc, addr, c.tls)
+	}
+	if err != nil {
+		c.failover(addr)
+		return nil, err
+	}
+	cn := &conn{Conn: nc, addr: addr, reader: bufio.NewReader(nc)}
+
+	// Ask for framed replies so values, nulls and errors can't be confused
+	replies, err := cn.roundTrip(ctx, []string{"HELLO 2"})
+	if err == nil && replies[0] != "+HELLO 2" {
+		err = fmt.Errorf("simple-kv: %s does not support framed replies: %s", addr, replies[0])
+	}
+	if err != nil {
+		cn.Close()
+		c.failover(addr)
+		return nil, err
+	}
+
+	if c.password != "" {
+		replies, err := cn.roundTrip(ctx, []string{fmt.Sprintf("AUTH %s %s", c.user, c.password)})
+		if err == nil {
+			err = expect(replies[0], "OK")
+		}
+		if err != nil {
+			// A wrong password is wrong on every node, so only fail over
+			// when the node couldn't be reached
+			cn.Close()
+			var serverErr *ServerError
+			if !errors.As(err, &serverErr) {
+				c.failover(addr)
+			}
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// handshake - run the TLS handshake on nc
+func handshake(ctx context.Context, nc net.Conn, addr string, cfg *tls.Config) (net.Conn, error) {
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tc := tls.Client(nc, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// put returns a healthy connection to the pool
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || len(c.idle) >= c.poolSize {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// failover - point new connections at the node after addr and drop idle
+// connections to addr, which are likely broken too
+func (c *Client) failover(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.addrs[c.next] == addr {
+		c.next = (c.next + 1) % len(c.addrs)
+	}
+
+	idle := c.idle[:0]
+	for _, cn := range c.idle {
+		if cn.addr == addr {
+			cn.Close()
+		} else {
+			idle = append(idle, cn)
+		}
+	}
+	c.idle = idle
+}
+
+// roundTrip writes every command and then reads one line per command
+func (cn *conn) roundTrip(ctx context.Context, cmds []string) ([]string, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		cn.SetDeadline(deadline)
+	} else {
+		cn.SetDeadline(time.Time{})
+	}
+
+	// Unblock reads and writes when the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		cn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	var b strings.Builder
+	for _, cmd := range cmds {
+		b.WriteString(cmd)
+		b.WriteByte('\n')
+	}
+	if _, err := cn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	replies := make([]string, len(cmds))
+	for i := range cmds {
+		line, err := cn.reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		replies[i] = strings.TrimRight(line, "\r\n")
+	}
+	return replies, nil
+}
+
+// checkArgs - keys and values travel as whitespace separated words with
+// '|' introducing metadata, so they can't contain either
+func checkArgs(args ...string) error {
+	for _, arg := range args {
+		if arg == "" || strings.IndexFunc(arg, unicode.IsSpace) >= 0 || strings.Contains(arg, "|") {
+			return fmt.Errorf("simple-kv: invalid argument %q: must be non-empty without whitespace or '|'", arg)
+		}
+	}
+	return nil
+}
+
+// parseReply - split a framed reply into its value, whether it was null,
+// or the error it carries
+func parseReply(reply string) (value string, null bool, err error) {
+	switch {
+	case strings.HasPrefix(reply, "+"):
+		return reply[1:], false, nil
+	case reply == "_":
+		return "", true, nil
+	case strings.HasPrefix(reply, "-"):
+		code, msg, _ := strings.Cut(reply[1:], " ")
+		if code == "ERR_WRONGTYPE" {
+			return "", false, ErrWrongType
+		}
+		return "", false, &ServerError{Code: code, Msg: msg}
+	}
+	return "", false, &ServerError{Msg: "unexpected reply: " + reply}
+}
+
+// parseGet - turn a GET reply into a value or a typed error
+func parseGet(reply string) (string, error) {
+	value, null, err := parseReply(reply)
+	if null {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+// expect - check a write got the reply it should have
+func expect(reply, want string) error {
+	value, _, err := parseReply(reply)
+	if err != nil {
+		return err
+	}
+	if value != want {
+		return &ServerError{Msg: "unexpected reply: " + reply}
+	}
+	return nil
+}
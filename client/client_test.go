@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+	"github.com/Ahmedhossamdev/simple-kv/certs"
+	"github.com/Ahmedhossamdev/simple-kv/internal/testcerts"
+	"github.com/Ahmedhossamdev/simple-kv/server"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestClient(t *testing.T) {
+	s := store.New()
+
+	go server.Start(":9049", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	// The first node is down, so every command has to fail over
+	c, err := New([]string{"localhost:1", "localhost:9049"}, WithDialTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Set(ctx, "client:a", "1"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, err := c.Get(ctx, "client:a"); err != nil || value != "1" {
+		t.Errorf("Expected 1, got %q (%v)", value, err)
+	}
+
+	if err := c.Del(ctx, "client:missing"); err != nil {
+		t.Errorf("Del of a missing key failed: %v", err)
+	}
+	if _, err := c.Get(ctx, "client:missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	s.HSet("client:hash", map[string]string{"f": "v"}, time.Now().UnixNano(), s.NewMsgID())
+	if _, err := c.Get(ctx, "client:hash"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+
+	values, err := c.MGet(ctx, "client:a", "client:missing")
+	if err != nil || len(values) != 1 || values["client:a"] != "1" {
+		t.Errorf("Unexpected MGet result: %v (%v)", values, err)
+	}
+
+	stats, err := c.Stats(ctx)
+	if err != nil || stats["total_keys"] == nil {
+		t.Errorf("Unexpected stats: %v (%v)", stats, err)
+	}
+
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+
+	info, err := c.Info(ctx, "keyspace")
+	if err != nil || info["keyspace"]["keys"] == nil || info["server"] != nil {
+		t.Errorf("Unexpected info: %v (%v)", info, err)
+	}
+
+	if err := c.Set(ctx, "client:a", "two words"); err == nil {
+		t.Error("Expected values with spaces to be rejected")
+	}
+	if err := c.Set(ctx, "client:a", "two\u00a0words"); err == nil {
+		t.Error("Expected values with a no-break space to be rejected")
+	}
+}
+
+func TestClientPipeline(t *testing.T) {
+	s := store.New()
+
+	go server.Start(":9050", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	c, _ := New([]string{"localhost:9050"})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := c.Pipeline()
+	p.Set("pipe:a", "1")
+	p.Get("pipe:a")
+	p.Del("pipe:a")
+	p.Get("pipe:a")
+
+	results, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+	if results[1].Value != "1" {
+		t.Errorf("Expected 1 from the pipelined GET, got %q", results[1].Value)
+	}
+	if !errors.Is(results[3].Err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after the pipelined DEL, got %v", results[3].Err)
+	}
+}
+
+func TestClientContextCancel(t *testing.T) {
+	c, _ := New([]string{"localhost:9049"})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.Set(ctx, "k", "v"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// startServer - start a node and shut it down when the test ends
+func startServer(t *testing.T, opts ...server.Option) {
+	srv := server.New(store.New(), opts...)
+	go srv.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	time.Sleep(200 * time.Millisecond)
+}
+
+func TestClientTLS(t *testing.T) {
+	tlsFiles := testcerts.Write(t, t.TempDir())
+	r, err := certs.New(tlsFiles.Cert, tlsFiles.Key, "")
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	startServer(t, server.WithAddr(":9067"), server.WithTLS(r))
+
+	pem, _ := os.ReadFile(tlsFiles.CA)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+
+	c, err := New([]string{"localhost:9067"}, WithTLS(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Set(ctx, "client:tls", "1"); err != nil {
+		t.Fatalf("Set over TLS failed: %v", err)
+	}
+	if value, err := c.Get(ctx, "client:tls"); err != nil || value != "1" {
+		t.Errorf("Expected 1, got %q (%v)", value, err)
+	}
+
+	// Without the CA the server's certificate can't be verified
+	plain, _ := New([]string{"localhost:9067"}, WithTLS(&tls.Config{}), WithRetries(0))
+	defer plain.Close()
+	if _, err := plain.Get(ctx, "client:tls"); err == nil {
+		t.Error("Expected an untrusted certificate to be refused")
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	users, err := acl.New([]acl.User{{Name: "app", Password: string(hash), Commands: []string{"*"}, Keys: []string{"*"}}})
+	if err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	startServer(t, server.WithAddr(":9070"), server.WithACL(users), server.WithPeerSecret("test-secret"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, _ := New([]string{"localhost:9070"}, WithAuth("app", "pass"))
+	defer c.Close()
+	if err := c.Set(ctx, "client:auth", "1"); err != nil {
+		t.Errorf("Set as app failed: %v", err)
+	}
+
+	anonymous, _ := New([]string{"localhost:9070"})
+	defer anonymous.Close()
+	var serverErr *ServerError
+	if err := anonymous.Set(ctx, "client:auth", "2"); !errors.As(err, &serverErr) || serverErr.Code != "ERR_AUTH" {
+		t.Errorf("Expected ERR_AUTH without a login, got %v", err)
+	}
+
+	wrong, _ := New([]string{"localhost:9070"}, WithAuth("app", "wrong"))
+	defer wrong.Close()
+	if _, err := wrong.Get(ctx, "client:auth"); !errors.As(err, &serverErr) || serverErr.Code != "ERR_AUTH" {
+		t.Errorf("Expected ERR_AUTH for a wrong password, got %v", err)
+	}
+}
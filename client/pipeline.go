@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pipeline queues commands and sends them in one write on one connection,
+// saving a round-trip per command. Commands are not atomic: other clients'
+// writes may land between them.
+type Pipeline struct {
+	c    *Client
+	cmds []string
+	errs []error // argument errors, reported by Exec
+}
+
+// Result is the outcome of one pipelined command
+type Result struct {
+	Value string
+	Err   error
+}
+
+// Pipeline starts a new pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Get queues a GET
+func (p *Pipeline) Get(key string) {
+	p.queue(checkArgs(key), "GET "+key)
+}
+
+// Set queues a SET
+func (p *Pipeline) Set(key, value string) {
+	p.queue(checkArgs(key, value), fmt.Sprintf("SET %s %s", key, value))
+}
+
+// Del queues a DEL
+func (p *Pipeline) Del(key string) {
+	p.queue(checkArgs(key), "DEL "+key)
+}
+
+func (p *Pipeline) queue(err error, cmd string) {
+	p.cmds = append(p.cmds, cmd)
+	p.errs = append(p.errs, err)
+}
+
+// Exec sends the queued commands and returns one Result per command in
+// the order they were queued. The returned error is only set when the
+// pipeline could not be sent at all.
+func (p *Pipeline) Exec(ctx context.Context) ([]Result, error) {
+	for _, err := range p.errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(p.cmds) == 0 {
+		return nil, nil
+	}
+
+	replies, err := p.c.do(ctx, p.cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(replies))
+	for i, reply := range replies {
+		switch p.cmds[i][:3] {
+		case "GET":
+			results[i].Value, results[i].Err = parseGet(reply)
+		case "SET":
+			results[i].Err = expect(reply, "OK")
+		case "DEL":
+			results[i].Err = expect(reply, "DELETED")
+		}
+	}
+
+	p.cmds, p.errs = nil, nil
+	return results, nil
+}
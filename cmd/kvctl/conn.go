@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// nodeConn is a connection to one node speaking the line protocol
+type nodeConn struct {
+	addr   string
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dial connects to addr, over TLS when cfg is set, and switches the
+// connection to framed replies
+func dial(addr string, timeout time.Duration, cfg *tls.Config) (*nodeConn, error) {
+	var conn net.Conn
+	var err error
+	if cfg != nil {
+		cfg = cfg.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, cfg)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := &nodeConn{addr: addr, conn: conn, reader: bufio.NewReader(conn)}
+
+	reply, err := n.send([]string{"HELLO", "2"}, timeout)
+	if err == nil && reply != "+HELLO 2" {
+		err = fmt.Errorf("%s does not support framed replies: %s", addr, reply)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *nodeConn) Close() error {
+	return n.conn.Close()
+}
+
+// isStreaming - commands after which the server keeps pushing lines
+func isStreaming(cmd string) bool {
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE", "WATCHKEYS", "CDC", "MONITOR":
+		return true
+	}
+	return false
+}
+
+// send writes one command and reads its reply, which is a single frame
+func (n *nodeConn) send(args []string, timeout time.Duration) (string, error) {
+	if timeout > 0 {
+		n.conn.SetDeadline(time.Now().Add(timeout))
+		defer n.conn.SetDeadline(time.Time{})
+	}
+
+	if _, err := fmt.Fprintln(n.conn, strings.Join(args, " ")); err != nil {
+		return "", err
+	}
+
+	return n.readLine()
+}
+
+// stream writes a streaming command and copies every pushed line to out
+// until the connection is closed
+func (n *nodeConn) stream(args []string, out func(line string)) error {
+	if _, err := fmt.Fprintln(n.conn, strings.Join(args, " ")); err != nil {
+		return err
+	}
+	for {
+		line, err := n.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out(line)
+	}
+}
+
+func (n *nodeConn) readLine() (string, error) {
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,490 @@
+// Command kvctl is the command line client for simple-kv.
+//
+//	kvctl [flags] COMMAND [args...]   run one command and exit
+//	kvctl [flags]                     interactive shell (or read commands from stdin)
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+)
+
+// commands is the list offered by tab completion
+var commands = []string{
+	"SET", "GET", "DEL", "TYPE",
+	"HSET", "HGET", "HGETALL", "HDEL", "HINCRBY",
+	"LPUSH", "RPUSH", "LPOP", "RPOP", "BLPOP", "BRPOP", "LRANGE", "LLEN",
+	"ZADD", "ZREM", "ZSCORE", "ZRANK", "ZRANGE", "ZRANGEBYSCORE", "ZINCRBY",
+	"SUBSCRIBE", "PSUBSCRIBE", "PUBLISH", "WATCHKEYS", "CDC",
+	"SYNC", "STATS", "INFO", "SLOWLOG", "MONITOR", "CLIENT", "PING", "HEALTH", "AUTH", "ACL",
+	// shell built-ins
+	"@ALL", "FORMAT", "HELP", "QUIT",
+}
+
+type cli struct {
+	nodes   []string
+	format  string
+	timeout time.Duration
+	tls     *tls.Config // nil for plain TCP
+
+	// Credentials for AUTH; no password means don't log in
+	user     string
+	password string
+
+	out io.Writer
+
+	conn *nodeConn // shell connection, dialled on first use
+}
+
+func main() {
+	nodes := flag.String("nodes", "localhost:8080", "comma-separated node addresses; the first reachable one is used")
+	format := flag.String("o", formatText, "output format: text, json or table")
+	all := flag.Bool("all", false, "send the command to every node")
+	timeout := flag.Duration("timeout", 0, "timeout per command (0 waits forever, e.g. for BLPOP)")
+	useTLS := flag.Bool("tls", false, "connect over TLS")
+	caFile := flag.String("cacert", "", "CA bundle to verify nodes with (implies -tls; default: system roots)")
+	certFile := flag.String("cert", "", "client certificate for mutual TLS (implies -tls)")
+	keyFile := flag.String("key", "", "key of the client certificate")
+	user := flag.String("user", "default", "user to log in as; the password is read from $SIMPLE_KV_PASSWORD")
+	hashPassword := flag.Bool("hash-password", false, "print the bcrypt hash of a password read from stdin, for the users file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: kvctl [flags] [COMMAND args...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *hashPassword {
+		if err := printPasswordHash(); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	c := &cli{
+		nodes:    strings.Split(*nodes, ","),
+		format:   *format,
+		timeout:  *timeout,
+		user:     *user,
+		password: os.Getenv("SIMPLE_KV_PASSWORD"),
+		out:      os.Stdout,
+	}
+	if err := checkFormat(c.format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *useTLS || *caFile != "" || *certFile != "" {
+		cfg, err := tlsConfig(*caFile, *certFile, *keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		c.tls = cfg
+	}
+
+	// One-shot: the shell has already done the quoting
+	if flag.NArg() > 0 {
+		if err := c.exec(flag.Args(), *all, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if err := c.repl(); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Commands piped on stdin, one per line
+	failed := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if err := c.line(scanner.Text(), *all, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// repl - interactive shell with history and tab completion
+func (c *cli) repl() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "kv> ")
+	t.AutoCompleteCallback = complete
+	c.out = t
+
+	fmt.Fprintf(t, "Connected to %s. Type HELP for help, QUIT to leave.\n", strings.Join(c.nodes, ", "))
+	for {
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "QUIT", "EXIT":
+			return nil
+		case "HELP":
+			fmt.Fprintln(t, "Any server command is sent to the current node, e.g. SET key value.")
+			fmt.Fprintln(t, "  @all COMMAND             send the command to every node")
+			fmt.Fprintln(t, "  FORMAT text|json|table   change the output format")
+			fmt.Fprintln(t, "  QUIT                     leave the shell")
+			fmt.Fprintln(t, "Streaming commands (SUBSCRIBE, WATCHKEYS, CDC, MONITOR) run until you press a key.")
+			continue
+		case "FORMAT":
+			if len(fields) != 2 || checkFormat(strings.ToLower(fields[1])) != nil {
+				fmt.Fprintln(t, "Usage: FORMAT text|json|table")
+				continue
+			}
+			c.format = strings.ToLower(fields[1])
+			continue
+		}
+
+		if err := c.line(line, false, stopOnKeypress); err != nil {
+			fmt.Fprintln(t, "❌", err)
+		}
+	}
+}
+
+// line - run one line of shell input; "@all" fans it out to every node
+func (c *cli) line(line string, all bool, stop func() <-chan struct{}) error {
+	args, err := splitArgs(line)
+	if err != nil || len(args) == 0 {
+		return err
+	}
+	if strings.EqualFold(args[0], "@all") {
+		all, args = true, args[1:]
+		if len(args) == 0 {
+			return errors.New("usage: @all COMMAND [args...]")
+		}
+	}
+	return c.exec(args, all, stop)
+}
+
+// exec - send a command to the current node or, with all, to every node
+func (c *cli) exec(args []string, all bool, stop func() <-chan struct{}) error {
+	for _, arg := range args {
+		if strings.IndexFunc(arg, unicode.IsSpace) >= 0 || strings.Contains(arg, "|") {
+			return fmt.Errorf("argument %q can't contain whitespace or '|'", arg)
+		}
+	}
+
+	if isStreaming(strings.ToUpper(args[0])) {
+		if all {
+			return errors.New("streaming commands can't be sent to every node")
+		}
+		return c.stream(args, stop)
+	}
+
+	if all {
+		printReplies(c.out, c.format, c.fanOut(args))
+		return nil
+	}
+
+	reply, err := c.send(args)
+	if err != nil {
+		return err
+	}
+	printReplies(c.out, c.format, []nodeReply{reply})
+	return nil
+}
+
+// send - run a command on the shell connection, reconnecting (to the next
+// reachable node if need be) when it has dropped
+func (c *cli) send(args []string) (nodeReply, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			conn, err := c.dialAny()
+			if err != nil {
+				return nodeReply{}, err
+			}
+			c.conn = conn
+		}
+
+		reply, err := c.conn.send(args, c.timeout)
+		if err == nil {
+			return parseFrame(c.conn.addr, reply), nil
+		}
+		c.conn.Close()
+		c.conn = nil
+
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nodeReply{}, err
+		}
+	}
+	return nodeReply{}, errors.New("connection lost")
+}
+
+// fanOut - run a command on every node in parallel
+func (c *cli) fanOut(args []string) []nodeReply {
+	replies := make([]nodeReply, len(c.nodes))
+
+	var wg sync.WaitGroup
+	for i, addr := range c.nodes {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+
+			conn, err := c.dial(addr)
+			if err != nil {
+				replies[i] = nodeReply{Node: addr, Err: err}
+				return
+			}
+			defer conn.Close()
+
+			reply, err := conn.send(args, c.timeout)
+			if err != nil {
+				replies[i] = nodeReply{Node: addr, Err: err}
+				return
+			}
+			replies[i] = parseFrame(addr, reply)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	return replies
+}
+
+// stream - run a streaming command on its own connection and print what
+// the server pushes until it closes the connection or stop fires
+func (c *cli) stream(args []string, stop func() <-chan struct{}) error {
+	conn, err := c.dialAny()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if stop != nil {
+		done := stop()
+		go func() {
+			<-done
+			conn.Close()
+		}()
+	}
+
+	err = conn.stream(args, func(line string) {
+		printReplies(c.out, c.format, []nodeReply{parseFrame(conn.addr, line)})
+	})
+	if stop != nil {
+		// Closed on purpose
+		return nil
+	}
+	return err
+}
+
+// dialAny - connect to the first reachable node
+func (c *cli) dialAny() (*nodeConn, error) {
+	var lastErr error
+	for _, addr := range c.nodes {
+		conn, err := c.dial(addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// dial - connect to addr and log in if a password was given
+func (c *cli) dial(addr string) (*nodeConn, error) {
+	conn, err := dial(addr, c.dialTimeout(), c.tls)
+	if err != nil || c.password == "" {
+		return conn, err
+	}
+
+	reply, err := conn.send([]string{"AUTH", c.user, c.password}, c.dialTimeout())
+	if err == nil && reply != "+OK" {
+		err = fmt.Errorf("%s: login failed: %s", addr, parseFrame(addr, reply).Reply)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *cli) dialTimeout() time.Duration {
+	if c.timeout > 0 {
+		return c.timeout
+	}
+	return 5 * time.Second
+}
+
+// stopOnKeypress - fires when a key is pressed on the raw terminal
+func stopOnKeypress() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		var b [1]byte
+		os.Stdin.Read(b[:])
+		close(done)
+	}()
+	return done
+}
+
+// complete - tab completion of the command word
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || strings.ContainsAny(line[:pos], " ") {
+		return "", 0, false
+	}
+
+	prefix := strings.ToUpper(line[:pos])
+	var matches []string
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd, prefix) {
+			matches = append(matches, cmd)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	// Complete as far as all matches agree
+	sort.Strings(matches)
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	return common + line[pos:], len(common), true
+}
+
+// splitArgs - split a line into words, honouring single and double quotes
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// printPasswordHash - read a password from the terminal (without echo) or
+// stdin and print its hash
+func printPasswordHash() error {
+	var password string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		password = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return errors.New("empty password")
+	}
+
+	hash, err := acl.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// tlsConfig - client TLS settings from the -cacert, -cert and -key flags
+func tlsConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case formatText, formatJSON, formatTable:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (want text, json or table)", format)
+}
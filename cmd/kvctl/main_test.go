@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/server"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`SET "my key" 'v'  x`)
+	if err != nil {
+		t.Fatalf("splitArgs failed: %v", err)
+	}
+	if len(args) != 4 || args[1] != "my key" || args[2] != "v" {
+		t.Errorf("Unexpected args: %q", args)
+	}
+
+	if _, err := splitArgs(`GET "open`); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	line, pos, ok := complete("hgeta", 5, '\t')
+	if !ok || line != "HGETALL " || pos != 8 {
+		t.Errorf("Unexpected completion: %q %d %v", line, pos, ok)
+	}
+
+	// Ambiguous prefixes complete as far as the matches agree
+	line, _, _ = complete("ZRANG", 5, '\t')
+	if line != "ZRANGE" {
+		t.Errorf("Expected ZRANGE, got %q", line)
+	}
+
+	if _, _, ok := complete("GET ke", 6, '\t'); ok {
+		t.Error("Expected no completion past the command word")
+	}
+}
+
+func TestPrintRepliesTable(t *testing.T) {
+	var out bytes.Buffer
+	printReplies(&out, formatTable, []nodeReply{{Node: "n1", Reply: `{"b":"2","a":"1"}`}})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "a") {
+		t.Errorf("Unexpected table:\n%s", out.String())
+	}
+
+	out.Reset()
+	printReplies(&out, formatJSON, []nodeReply{{Node: "n1", Reply: `["x"]`}, {Node: "n2", Reply: "OK"}})
+	if strings.TrimSpace(out.String()) != `[{"node":"n1","reply":["x"]},{"node":"n2","reply":"OK"}]` {
+		t.Errorf("Unexpected JSON output: %s", out.String())
+	}
+}
+
+func TestExecFanOut(t *testing.T) {
+	s1 := store.New()
+	s2 := store.New()
+
+	go server.Start(":9052", s1, []string{})
+	go server.Start(":9053", s2, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	var out bytes.Buffer
+	c := &cli{
+		nodes:   []string{"localhost:9052", "localhost:9053"},
+		format:  formatText,
+		timeout: 2 * time.Second,
+		out:     &out,
+	}
+
+	if err := c.exec([]string{"SET", "kvctl", "1"}, false, nil); err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "OK" {
+		t.Errorf("Expected OK, got: %s", out.String())
+	}
+
+	out.Reset()
+	if err := c.line("@all TYPE kvctl", false, nil); err != nil {
+		t.Fatalf("fan out failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "localhost:9052: string") || !strings.Contains(out.String(), "localhost:9053: none") {
+		t.Errorf("Unexpected fan out output: %s", out.String())
+	}
+
+	// The whole snapshot is read, not just the SNAPSHOT: marker
+	out.Reset()
+	c.exec([]string{"SYNC"}, false, nil)
+	if !strings.Contains(out.String(), "kvctl") {
+		t.Errorf("Expected the snapshot, got: %s", out.String())
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+// nodeReply is the reply one node gave to a command
+type nodeReply struct {
+	Node  string
+	Reply string // the value, or the message of an error reply
+	Code  string // error code of an error reply
+	Null  bool
+	Err   error // the node could not be reached
+}
+
+// parseFrame - decode one framed line from node
+func parseFrame(node, line string) nodeReply {
+	r := nodeReply{Node: node}
+	switch {
+	case line == "_":
+		r.Null = true
+	case strings.HasPrefix(line, "-"):
+		r.Code, r.Reply, _ = strings.Cut(line[1:], " ")
+	case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ">"):
+		r.Reply = line[1:]
+	default:
+		r.Reply = line
+	}
+	return r
+}
+
+// MarshalJSON - embed JSON replies as JSON, everything else as a string
+func (r nodeReply) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{"node": r.Node}
+	switch {
+	case r.Err != nil:
+		out["error"] = map[string]string{"message": r.Err.Error()}
+	case r.Code != "":
+		out["error"] = map[string]string{"code": r.Code, "message": r.Reply}
+	case r.Null:
+		out["reply"] = nil
+	case json.Valid([]byte(r.Reply)) && isJSONContainer(r.Reply):
+		out["reply"] = json.RawMessage(r.Reply)
+	default:
+		out["reply"] = r.Reply
+	}
+	return json.Marshal(out)
+}
+
+func isJSONContainer(s string) bool {
+	return strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")
+}
+
+// printReplies writes the replies in the requested format. A single reply is
+// printed on its own; fanned out replies are labelled with their node.
+func printReplies(w io.Writer, format string, replies []nodeReply) {
+	switch format {
+	case formatJSON:
+		var out []byte
+		if len(replies) == 1 {
+			out, _ = json.Marshal(replies[0])
+		} else {
+			out, _ = json.Marshal(replies)
+		}
+		fmt.Fprintln(w, string(out))
+
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		if len(replies) == 1 {
+			writeTable(tw, replies[0])
+		} else {
+			fmt.Fprintln(tw, "NODE\tREPLY")
+			for _, r := range replies {
+				fmt.Fprintf(tw, "%s\t%s\n", r.Node, replyText(r))
+			}
+		}
+		tw.Flush()
+
+	default:
+		for _, r := range replies {
+			if len(replies) > 1 {
+				fmt.Fprintf(w, "%s: %s\n", r.Node, replyText(r))
+			} else {
+				fmt.Fprintln(w, replyText(r))
+			}
+		}
+	}
+}
+
+func replyText(r nodeReply) string {
+	switch {
+	case r.Err != nil:
+		return "(error) " + r.Err.Error()
+	case r.Code != "":
+		return fmt.Sprintf("(error) %s %s", r.Code, r.Reply)
+	case r.Null:
+		return "(nil)"
+	}
+	return r.Reply
+}
+
+// writeTable - lay out JSON objects as key/value rows and JSON arrays as
+// one row per element; anything else is printed as is
+func writeTable(w io.Writer, r nodeReply) {
+	if r.Err != nil || r.Code != "" || r.Null || !isJSONContainer(r.Reply) {
+		fmt.Fprintln(w, replyText(r))
+		return
+	}
+
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(r.Reply), &obj) == nil {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintln(w, "KEY\tVALUE")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", k, cell(obj[k]))
+		}
+		return
+	}
+
+	var rows []interface{}
+	if json.Unmarshal([]byte(r.Reply), &rows) != nil {
+		fmt.Fprintln(w, r.Reply)
+		return
+	}
+
+	// Arrays of objects, such as ZRANGE ... WITHSCORES, get a column per field
+	var columns []string
+	if len(rows) > 0 {
+		if first, ok := rows[0].(map[string]interface{}); ok {
+			for k := range first {
+				columns = append(columns, k)
+			}
+			sort.Strings(columns)
+		}
+	}
+
+	if columns == nil {
+		fmt.Fprintln(w, "#\tVALUE")
+		for i, row := range rows {
+			fmt.Fprintf(w, "%d\t%s\n", i, cell(row))
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "#\t%s\n", strings.ToUpper(strings.Join(columns, "\t")))
+	for i, row := range rows {
+		obj, _ := row.(map[string]interface{})
+		cells := make([]string, len(columns))
+		for j, c := range columns {
+			cells[j] = cell(obj[c])
+		}
+		fmt.Fprintf(w, "%d\t%s\n", i, strings.Join(cells, "\t"))
+	}
+}
+
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		out, _ := json.Marshal(v)
+		return string(out)
+	}
+}
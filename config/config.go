@@ -0,0 +1,414 @@
+// Package config loads the settings of a node. Each setting can come from
+// a YAML file, an environment variable or a command line flag; flags win
+// over environment variables, which win over the file, which wins over the
+// defaults.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything a node can be configured with
+type Config struct {
+	// NodeID is carried in msg-ids to tell where writes came from; the
+	// listen address is used when empty
+	NodeID string `yaml:"node_id"`
+
+	Listen struct {
+		TCP  string `yaml:"tcp"`
+		HTTP string `yaml:"http"` // empty: no HTTP API
+		GRPC string `yaml:"grpc"` // empty: no gRPC API
+	} `yaml:"listen"`
+
+	Peers      []string `yaml:"peers"`
+	PeerSecret string   `yaml:"peer_secret"`
+
+	TLS struct {
+		Cert string `yaml:"cert"`
+		Key  string `yaml:"key"`
+		CA   string `yaml:"ca"`
+	} `yaml:"tls"`
+
+	// UsersFile turns on AUTH and ACLs (see package acl)
+	UsersFile string `yaml:"users_file"`
+
+	Sync struct {
+		StartupDelay        time.Duration `yaml:"startup_delay"`
+		Interval            time.Duration `yaml:"interval"`
+		HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	} `yaml:"sync"`
+
+	Timeouts struct {
+		PeerDial    time.Duration `yaml:"peer_dial"`
+		Sync        time.Duration `yaml:"sync"`
+		HealthCheck time.Duration `yaml:"health_check"`
+		Shutdown    time.Duration `yaml:"shutdown"`
+		Ready       time.Duration `yaml:"ready"`
+	} `yaml:"timeouts"`
+
+	Limits struct {
+		MaxInFlight        int   `yaml:"max_in_flight"`
+		MaxHTTPBody        int64 `yaml:"max_http_body"`
+		ChangeLogRetention int   `yaml:"change_log_retention"`
+	} `yaml:"limits"`
+
+	Persistence struct {
+		Dir      string        `yaml:"dir"` // empty: keep everything in memory only
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"persistence"`
+
+	SlowLog struct {
+		// Threshold is how long a command must take to be recorded; a
+		// negative threshold turns the slow log off
+		Threshold time.Duration `yaml:"threshold"`
+		MaxLen    int           `yaml:"max_len"`
+	} `yaml:"slowlog"`
+
+	Log struct {
+		Level  string `yaml:"level"`  // debug, info, warn or error
+		Format string `yaml:"format"` // text or json
+		// Values logs the arguments of commands in full instead of only
+		// their keys. Passwords are never logged.
+		Values bool `yaml:"values"`
+	} `yaml:"log"`
+}
+
+// Default returns the settings used when nothing else is given
+func Default() *Config {
+	c := &Config{}
+	c.Listen.TCP = ":8080"
+	c.Sync.StartupDelay = 3 * time.Second
+	c.Sync.Interval = 30 * time.Second
+	c.Sync.HealthCheckInterval = 10 * time.Second
+	c.Timeouts.PeerDial = 3 * time.Second
+	c.Timeouts.Sync = 5 * time.Second
+	c.Timeouts.HealthCheck = 2 * time.Second
+	c.Timeouts.Shutdown = 8 * time.Second
+	c.Timeouts.Ready = 30 * time.Second
+	c.Limits.MaxInFlight = 256
+	c.Limits.MaxHTTPBody = 1 << 20
+	c.Limits.ChangeLogRetention = 10000
+	c.Persistence.Interval = 10 * time.Second
+	c.SlowLog.Threshold = 10 * time.Millisecond
+	c.SlowLog.MaxLen = 128
+	c.Log.Level = "info"
+	c.Log.Format = "text"
+	return c
+}
+
+// setting is one entry that can be set from the environment or a flag
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func str(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func duration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 10s or 1m", v)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func boolean(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", v)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func integer(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"node-id", "SIMPLE_KV_NODE_ID", "node ID carried in msg-ids (default: the listen address)",
+		str(func(c *Config) *string { return &c.NodeID })},
+	{"listen", "SIMPLE_KV_LISTEN", "address of the TCP listener",
+		str(func(c *Config) *string { return &c.Listen.TCP })},
+	{"http", "SIMPLE_KV_HTTP", "address of the HTTP API (default: off)",
+		str(func(c *Config) *string { return &c.Listen.HTTP })},
+	{"grpc", "SIMPLE_KV_GRPC", "address of the gRPC API (default: off)",
+		str(func(c *Config) *string { return &c.Listen.GRPC })},
+	{"peers", "SIMPLE_KV_PEERS", "comma-separated peer addresses",
+		func(c *Config, v string) error {
+			c.Peers = nil
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					c.Peers = append(c.Peers, p)
+				}
+			}
+			return nil
+		}},
+	{"peer-secret", "SIMPLE_KV_PEER_SECRET", "shared secret peers authenticate each other with",
+		str(func(c *Config) *string { return &c.PeerSecret })},
+	{"tls-cert", "SIMPLE_KV_TLS_CERT", "TLS certificate (PEM); turns on TLS",
+		str(func(c *Config) *string { return &c.TLS.Cert })},
+	{"tls-key", "SIMPLE_KV_TLS_KEY", "key of the TLS certificate",
+		str(func(c *Config) *string { return &c.TLS.Key })},
+	{"tls-ca", "SIMPLE_KV_TLS_CA", "CA bundle for mutual TLS between peers",
+		str(func(c *Config) *string { return &c.TLS.CA })},
+	{"users", "SIMPLE_KV_USERS", "users file; turns on AUTH and ACLs",
+		str(func(c *Config) *string { return &c.UsersFile })},
+	{"sync-startup-delay", "SIMPLE_KV_SYNC_STARTUP_DELAY", "wait before the startup sync",
+		duration(func(c *Config) *time.Duration { return &c.Sync.StartupDelay })},
+	{"sync-interval", "SIMPLE_KV_SYNC_INTERVAL", "time between periodic syncs",
+		duration(func(c *Config) *time.Duration { return &c.Sync.Interval })},
+	{"health-check-interval", "SIMPLE_KV_HEALTH_CHECK_INTERVAL", "time between peer health checks",
+		duration(func(c *Config) *time.Duration { return &c.Sync.HealthCheckInterval })},
+	{"peer-dial-timeout", "SIMPLE_KV_PEER_DIAL_TIMEOUT", "timeout for connecting to a peer to replicate",
+		duration(func(c *Config) *time.Duration { return &c.Timeouts.PeerDial })},
+	{"sync-timeout", "SIMPLE_KV_SYNC_TIMEOUT", "timeout for connecting to a peer to sync",
+		duration(func(c *Config) *time.Duration { return &c.Timeouts.Sync })},
+	{"health-check-timeout", "SIMPLE_KV_HEALTH_CHECK_TIMEOUT", "timeout of a peer health check",
+		duration(func(c *Config) *time.Duration { return &c.Timeouts.HealthCheck })},
+	{"shutdown-timeout", "SIMPLE_KV_SHUTDOWN_TIMEOUT", "how long to drain connections on SIGTERM before closing them",
+		duration(func(c *Config) *time.Duration { return &c.Timeouts.Shutdown })},
+	{"ready-timeout", "SIMPLE_KV_READY_TIMEOUT", "how long the startup sync may take before the node reports ready anyway",
+		duration(func(c *Config) *time.Duration { return &c.Timeouts.Ready })},
+	{"max-in-flight", "SIMPLE_KV_MAX_IN_FLIGHT", "req-id requests a connection may run at once",
+		integer(func(c *Config) *int { return &c.Limits.MaxInFlight })},
+	{"max-http-body", "SIMPLE_KV_MAX_HTTP_BODY", "largest HTTP request body in bytes",
+		func(c *Config, v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", v)
+			}
+			c.Limits.MaxHTTPBody = n
+			return nil
+		}},
+	{"change-log-retention", "SIMPLE_KV_CHANGE_LOG_RETENTION", "changes kept for CDC",
+		integer(func(c *Config) *int { return &c.Limits.ChangeLogRetention })},
+	{"data-dir", "SIMPLE_KV_DATA_DIR", "directory snapshots are saved to (default: memory only)",
+		str(func(c *Config) *string { return &c.Persistence.Dir })},
+	{"save-interval", "SIMPLE_KV_SAVE_INTERVAL", "time between snapshots saved to the data dir",
+		duration(func(c *Config) *time.Duration { return &c.Persistence.Interval })},
+	{"slowlog-threshold", "SIMPLE_KV_SLOWLOG_THRESHOLD", "record commands taking at least this long in the slow log; negative turns it off",
+		duration(func(c *Config) *time.Duration { return &c.SlowLog.Threshold })},
+	{"slowlog-max-len", "SIMPLE_KV_SLOWLOG_MAX_LEN", "how many entries the slow log keeps",
+		integer(func(c *Config) *int { return &c.SlowLog.MaxLen })},
+	{"log-level", "SIMPLE_KV_LOG_LEVEL", "debug, info, warn or error; debug logs every command",
+		str(func(c *Config) *string { return &c.Log.Level })},
+	{"log-format", "SIMPLE_KV_LOG_FORMAT", "text or json",
+		str(func(c *Config) *string { return &c.Log.Format })},
+	{"log-values", "SIMPLE_KV_LOG_VALUES", "log command arguments in full instead of only keys",
+		boolean(func(c *Config) *bool { return &c.Log.Values })},
+}
+
+// Load builds the configuration from the command line arguments (without
+// the program name) and the environment, reading the file named by -config
+// or SIMPLE_KV_CONFIG first. -h prints the flags to usage and returns
+// flag.ErrHelp.
+func Load(args []string, getenv func(string) string, usage io.Writer) (*Config, error) {
+	fs := flag.NewFlagSet("simple-kv", flag.ContinueOnError)
+	fs.SetOutput(usage)
+	configFile := fs.String("config", getenv("SIMPLE_KV_CONFIG"), "YAML config file (env SIMPLE_KV_CONFIG)")
+
+	flagValues := make(map[string]*string)
+	for _, st := range settings {
+		flagValues[st.flag] = fs.String(st.flag, "", fmt.Sprintf("%s (env %s)", st.usage, st.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("config: unexpected argument %q; use -listen and -peers instead of positional arguments", fs.Arg(0))
+	}
+
+	c := Default()
+	if *configFile != "" {
+		if err := c.readFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, st := range settings {
+		if v := getenv(st.env); v != "" {
+			if err := st.set(c, v); err != nil {
+				errs = append(errs, fmt.Errorf("config: %s: %w", st.env, err))
+			}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, st := range settings {
+			if st.flag == f.Name {
+				if err := st.set(c, *flagValues[st.flag]); err != nil {
+					errs = append(errs, fmt.Errorf("config: -%s: %w", st.flag, err))
+				}
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readFile - overlay the settings in a YAML file; unknown keys are errors
+// so typos don't go unnoticed
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the settings, reporting every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("config: "+format, args...))
+	}
+
+	if c.Listen.TCP == "" {
+		fail("listen.tcp must be set")
+	}
+	for name, addr := range map[string]string{"listen.tcp": c.Listen.TCP, "listen.http": c.Listen.HTTP, "listen.grpc": c.Listen.GRPC} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			fail("%s: %q is not a host:port address", name, addr)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range c.Peers {
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			fail("peers: %q is not a host:port address", p)
+		}
+		if seen[p] {
+			fail("peers: %s is listed twice", p)
+		}
+		seen[p] = true
+	}
+
+	// An empty secret is no secret: anyone could authenticate as a peer
+	if len(c.Peers) > 0 && c.PeerSecret == "" && c.TLS.CA == "" {
+		fail("peer_secret must be set when peers are configured (or tls.ca, for mutual TLS)")
+	}
+
+	// Peers skip the ACLs, so they need a secret whatever vouches for them
+	if c.UsersFile != "" && c.PeerSecret == "" {
+		fail("peer_secret must be set when users_file is")
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		fail("tls.cert and tls.key must be set together")
+	}
+	if c.TLS.CA != "" && c.TLS.Cert == "" {
+		fail("tls.ca needs tls.cert and tls.key")
+	}
+
+	for name, d := range map[string]time.Duration{
+		"sync.interval":              c.Sync.Interval,
+		"sync.health_check_interval": c.Sync.HealthCheckInterval,
+		"timeouts.peer_dial":         c.Timeouts.PeerDial,
+		"timeouts.sync":              c.Timeouts.Sync,
+		"timeouts.health_check":      c.Timeouts.HealthCheck,
+		"timeouts.shutdown":          c.Timeouts.Shutdown,
+		"timeouts.ready":             c.Timeouts.Ready,
+		"persistence.interval":       c.Persistence.Interval,
+	} {
+		if d <= 0 {
+			fail("%s must be positive, got %s", name, d)
+		}
+	}
+	if c.Sync.StartupDelay < 0 {
+		fail("sync.startup_delay must not be negative, got %s", c.Sync.StartupDelay)
+	}
+
+	if c.Limits.MaxInFlight <= 0 {
+		fail("limits.max_in_flight must be positive, got %d", c.Limits.MaxInFlight)
+	}
+	if c.Limits.MaxHTTPBody <= 0 {
+		fail("limits.max_http_body must be positive, got %d", c.Limits.MaxHTTPBody)
+	}
+	if c.Limits.ChangeLogRetention <= 0 {
+		fail("limits.change_log_retention must be positive, got %d", c.Limits.ChangeLogRetention)
+	}
+
+	if c.SlowLog.Threshold == 0 {
+		fail("slowlog.threshold must not be zero; use 1us to record every command or a negative value to turn it off")
+	}
+	if c.SlowLog.MaxLen <= 0 {
+		fail("slowlog.max_len must be positive, got %d", c.SlowLog.MaxLen)
+	}
+	if c.Persistence.Dir != "" {
+		if fi, err := os.Stat(c.Persistence.Dir); err != nil || !fi.IsDir() {
+			fail("persistence.dir: %s is not a directory", c.Persistence.Dir)
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		fail("log.format must be text or json, got %q", c.Log.Format)
+	}
+
+	// Map order is random; keep the report stable
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// Logger returns a logger writing to w at the configured level and format
+func (c *Config) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Log.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Log.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "simple-kv.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+node_id: from-file
+listen:
+  tcp: ":9000"
+  http: ":9001"
+peers: [a:1, b:2]
+sync:
+  interval: 1m
+limits:
+  max_in_flight: 16
+`)
+
+	c, err := Load(
+		[]string{"-config", path, "-listen", ":7000", "-peers", ""},
+		env(map[string]string{"SIMPLE_KV_LISTEN": ":8000", "SIMPLE_KV_SYNC_INTERVAL": "45s", "SIMPLE_KV_NODE_ID": "from-env"}),
+		io.Discard,
+	)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if c.Listen.TCP != ":7000" {
+		t.Errorf("Expected the flag to win, got %s", c.Listen.TCP)
+	}
+	if c.NodeID != "from-env" || c.Sync.Interval != 45*time.Second {
+		t.Errorf("Expected the environment to win over the file, got %s and %s", c.NodeID, c.Sync.Interval)
+	}
+	if c.Listen.HTTP != ":9001" || c.Limits.MaxInFlight != 16 {
+		t.Errorf("Expected settings from the file, got %+v", c)
+	}
+	if len(c.Peers) != 0 {
+		t.Errorf("Expected -peers \"\" to clear the peers, got %v", c.Peers)
+	}
+	if c.Sync.HealthCheckInterval != 10*time.Second {
+		t.Errorf("Expected the default health check interval, got %s", c.Sync.HealthCheckInterval)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		"positional arguments": {
+			args: []string{"8080", "localhost:8081"},
+			want: []string{`unexpected argument "8080"`},
+		},
+		"unknown key in file": {
+			args: []string{"-config", writeFile(t, "sync:\n  intervall: 1s\n")},
+			want: []string{"intervall"},
+		},
+		"bad values": {
+			args: []string{"-sync-interval", "soon", "-peers", "localhost"},
+			env:  map[string]string{"SIMPLE_KV_MAX_IN_FLIGHT": "many"},
+			want: []string{"-sync-interval", "SIMPLE_KV_MAX_IN_FLIGHT"},
+		},
+		"invalid settings": {
+			args: []string{"-peers", "localhost,a:1,a:1", "-tls-key", "key.pem", "-health-check-interval", "-1s"},
+			want: []string{`"localhost" is not a host:port`, "a:1 is listed twice", "tls.cert and tls.key", "sync.health_check_interval must be positive"},
+		},
+		"peers without a secret": {
+			args: []string{"-peers", "a:1"},
+			want: []string{"peer_secret must be set"},
+		},
+		"users without a peer secret": {
+			args: []string{"-users", "users.json", "-tls-cert", "c.pem", "-tls-key", "k.pem", "-tls-ca", "ca.pem"},
+			want: []string{"peer_secret must be set when users_file is"},
+		},
+		"invalid log settings": {
+			args: []string{"-log-level", "loud"},
+			env:  map[string]string{"SIMPLE_KV_LOG_FORMAT": "xml"},
+			want: []string{"log.level must be", "log.format must be text or json"},
+		},
+		"invalid slow log settings": {
+			args: []string{"-slowlog-threshold", "0s", "-slowlog-max-len", "0"},
+			want: []string{"slowlog.threshold must not be zero", "slowlog.max_len must be positive"},
+		},
+	} {
+		_, err := Load(tc.args, env(tc.env), io.Discard)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: expected %q in %q", name, want, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package kvpb holds the protobuf messages and gRPC services generated from
+// kv.proto. Regenerate with `go generate ./kvpb` after editing the proto.
+package kvpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kv.proto
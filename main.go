@@ -1,25 +1,104 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+	"github.com/Ahmedhossamdev/simple-kv/certs"
+	"github.com/Ahmedhossamdev/simple-kv/config"
 	"github.com/Ahmedhossamdev/simple-kv/server"
 	"github.com/Ahmedhossamdev/simple-kv/store"
 )
 
 func main() {
-	port := "8080"
-	if len(os.Args) > 1 {
-		port = os.Args[1]
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	var peers []string
-	if len(os.Args) > 2 {
-		peers = strings.Split(os.Args[2], ",")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
+	logger := cfg.Logger(os.Stderr)
+	slog.SetDefault(logger)
+
 	s := store.New()
-	log.Fatal(server.Start(":"+port, s, peers))
+	s.SetNodeID(cfg.NodeID)
+	s.SetChangeLogRetention(cfg.Limits.ChangeLogRetention)
+
+	opts := []server.Option{
+		server.WithAddr(cfg.Listen.TCP),
+		server.WithHTTPAddr(cfg.Listen.HTTP),
+		server.WithGRPCAddr(cfg.Listen.GRPC),
+		server.WithPeers(cfg.Peers...),
+		// Shared secret peers authenticate each other with
+		server.WithPeerSecret(cfg.PeerSecret),
+		server.WithLogger(logger),
+		server.WithLogValues(cfg.Log.Values),
+		server.WithSettings(server.Settings{
+			SyncStartupDelay:    cfg.Sync.StartupDelay,
+			SyncInterval:        cfg.Sync.Interval,
+			HealthCheckInterval: cfg.Sync.HealthCheckInterval,
+			SyncTimeout:         cfg.Timeouts.Sync,
+			HealthCheckTimeout:  cfg.Timeouts.HealthCheck,
+			PeerDialTimeout:     cfg.Timeouts.PeerDial,
+			ShutdownTimeout:     cfg.Timeouts.Shutdown,
+			ReadyTimeout:        cfg.Timeouts.Ready,
+			SlowLogThreshold:    cfg.SlowLog.Threshold,
+			SlowLogMaxLen:       cfg.SlowLog.MaxLen,
+			MaxInFlight:         cfg.Limits.MaxInFlight,
+			MaxHTTPBody:         cfg.Limits.MaxHTTPBody,
+		}),
+	}
+
+	// Optional TLS for clients and peers; with a CA, peers use mutual TLS
+	if cfg.TLS.Cert != "" {
+		r, err := certs.New(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.CA)
+		if err != nil {
+			fatal(err)
+		}
+		opts = append(opts, server.WithTLS(r))
+	}
+
+	// Optional users file; clients then have to log in with AUTH
+	if cfg.UsersFile != "" {
+		users, err := acl.Load(cfg.UsersFile)
+		if err != nil {
+			fatal(err)
+		}
+		opts = append(opts, server.WithACL(users))
+	}
+
+	// Optional persistence: restore the last snapshot, then save regularly
+	if cfg.Persistence.Dir != "" {
+		opts = append(opts, server.WithDataDir(cfg.Persistence.Dir, cfg.Persistence.Interval))
+	}
+
+	// Shut down cleanly on SIGTERM (docker stop) and SIGINT (Ctrl-C); a
+	// second signal kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		logger.Info("shutting down")
+	}()
+
+	if err := server.New(s, opts...).Run(ctx); err != nil {
+		fatal(err)
+	}
+	logger.Info("stopped")
+}
+
+// fatal - log err and exit
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
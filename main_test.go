@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain gives the nodes the tests start with server.Start a shared peer
+// secret, which Start reads from the environment
+func TestMain(m *testing.M) {
+	if os.Getenv("SIMPLE_KV_PEER_SECRET") == "" {
+		os.Setenv("SIMPLE_KV_PEER_SECRET", "test-secret")
+	}
+	os.Exit(m.Run())
+}
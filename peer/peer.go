@@ -1,20 +1,333 @@
 package peer
 
 import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/certs"
 )
 
-func BroadcastToPeers(peers []string, message string) {
-	for _, peer := range peers {
-		go func(peer string) {
-			conn, err := net.Dial("tcp", peer)
+// DefaultTimeout is used by a Client without a Timeout
+const DefaultTimeout = 3 * time.Second
+
+// StreamIdleTimeout is how long the connection writes are broadcast over
+// stays open without writes
+const StreamIdleTimeout = 30 * time.Second
+
+// Dialer opens the raw connections to peers; *net.Dialer is one
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Client connects to the peers of one node. Every node of a cluster must
+// use the same Secret. A Client must not be changed once it is in use; the
+// zero value dials plain TCP without a secret.
+type Client struct {
+	// Secret is the shared secret peers authenticate each other with
+	Secret string
+	// TLS, when set, makes the Client connect over TLS, presenting the
+	// node's certificate and verifying the peer's against the CA
+	TLS *certs.Reloader
+	// Timeout bounds connecting to a peer to replicate a write
+	Timeout time.Duration
+	// Dialer opens connections; nil uses a net.Dialer
+	Dialer Dialer
+	// Logger reports failed broadcasts; nil uses slog.Default()
+	Logger *slog.Logger
+	// Sent, when set, is told how sending each broadcast write to a peer
+	// went; err is nil once the write is sent
+	Sent func(peer string, err error)
+
+	// broadcasting counts writes still being sent to a peer
+	broadcasting atomic.Int64
+
+	mu      sync.Mutex
+	streams map[string]*stream // by peer address
+}
+
+// NewChallenge returns a random nonce for a peer to sign
+func NewChallenge() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the response to a challenge: HMAC-SHA256 of the nonce keyed
+// with the shared secret
+func (c *Client) Sign(nonce string) string {
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a peer's response to a challenge
+func (c *Client) Verify(nonce, response string) bool {
+	return hmac.Equal([]byte(c.Sign(nonce)), []byte(response))
+}
+
+// Dial connects to a peer like DialContext, giving up after timeout
+func (c *Client) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.DialContext(ctx, addr)
+}
+
+// DialContext connects to a peer and authenticates as a peer, so that the
+// msg-id and timestamp sent with replicated writes are accepted:
+//
+//	-> PEER HELLO
+//	<- CHALLENGE <nonce>
+//	-> PEER AUTH <hmac>
+//	<- OK
+//
+// ctx bounds connecting and the handshake, not the use of the connection.
+func (c *Client) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	var d Dialer = &net.Dialer{}
+	if c.Dialer != nil {
+		d = c.Dialer
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.TLS != nil {
+		host, _, _ := net.SplitHostPort(addr)
+		tc := tls.Client(conn, c.TLS.ClientConfig(host))
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	reader := bufio.NewReader(conn)
+	fmt.Fprintln(conn, "PEER HELLO")
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	nonce, ok := strings.CutPrefix(strings.TrimSpace(line), "CHALLENGE ")
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("peer %s refused the handshake: %s", addr, strings.TrimSpace(line))
+	}
+
+	fmt.Fprintln(conn, "PEER AUTH", c.Sign(nonce))
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if strings.TrimSpace(line) != "OK" {
+		conn.Close()
+		return nil, fmt.Errorf("peer %s rejected authentication: %s", addr, strings.TrimSpace(line))
+	}
+	return conn, nil
+}
+
+// Broadcast sends message to every peer in the background. Each peer gets
+// its writes in the order they were broadcast, over one connection that is
+// kept open while writes keep coming, so a write is never applied before
+// one broadcast earlier.
+func (c *Client) Broadcast(peers []string, message string) {
+	for _, addr := range peers {
+		c.broadcasting.Add(1)
+		c.stream(addr).send(message)
+	}
+}
+
+// stream returns the stream of writes to addr
+func (c *Client) stream(addr string) *stream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.streams == nil {
+		c.streams = make(map[string]*stream)
+	}
+	st, ok := c.streams[addr]
+	if !ok {
+		st = &stream{c: c, addr: addr, wake: make(chan struct{}, 1)}
+		c.streams[addr] = st
+	}
+	return st
+}
+
+// Close hangs up the connections to peers once the writes queued for them
+// are sent. Later broadcasts connect again.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, st := range c.streams {
+		st.mu.Lock()
+		st.closing = true
+		st.mu.Unlock()
+		st.signal()
+	}
+}
+
+// stream sends the writes for one peer, in order, from a single goroutine
+// that runs while there are writes to send and for StreamIdleTimeout after
+type stream struct {
+	c    *Client
+	addr string
+	wake chan struct{} // signalled when a write is queued
+
+	mu      sync.Mutex
+	queue   []string
+	running bool
+	closing bool // set by Client.Close
+}
+
+func (st *stream) send(message string) {
+	st.mu.Lock()
+	st.queue = append(st.queue, message)
+	st.closing = false
+	start := !st.running
+	st.running = true
+	st.mu.Unlock()
+
+	if start {
+		go st.run()
+	} else {
+		st.signal()
+	}
+}
+
+func (st *stream) signal() {
+	select {
+	case st.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next - the queued writes, or nil once the stream should stop because
+// it was closed or has been idle
+func (st *stream) next(idle <-chan time.Time) []string {
+	for {
+		st.mu.Lock()
+		if batch := st.queue; len(batch) > 0 {
+			st.queue = nil
+			st.mu.Unlock()
+			return batch
+		}
+		if st.closing {
+			st.running = false
+			st.mu.Unlock()
+			return nil
+		}
+		st.mu.Unlock()
+
+		select {
+		case <-st.wake:
+		case <-idle:
+			st.mu.Lock()
+			if len(st.queue) == 0 {
+				st.running = false
+				st.mu.Unlock()
+				return nil
+			}
+			st.mu.Unlock()
+		}
+	}
+}
+
+func (st *stream) run() {
+	c := st.c
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	idle := time.NewTimer(StreamIdleTimeout)
+	defer idle.Stop()
+	for {
+		batch := st.next(idle.C)
+		if batch == nil {
+			return
+		}
+
+		var err error
+		if conn == nil {
+			if conn, err = c.Dial(st.addr, timeout); err == nil {
+				// Replies aren't needed, but must be read for the peer
+				// to keep going
+				go io.Copy(io.Discard, conn)
+			}
+		}
+		for _, message := range batch {
+			if err == nil {
+				conn.SetWriteDeadline(time.Now().Add(timeout))
+				_, err = fmt.Fprintln(conn, message)
+			}
+			// Once the connection fails the rest of the batch is dropped;
+			// the periodic sync catches the peer up
 			if err != nil {
-				fmt.Println("Failed to connect to peer:", err)
-				return
+				c.logger().Warn("replicating to peer failed", "peer", st.addr, "err", err)
 			}
-			defer conn.Close()
-			fmt.Fprintln(conn, message)
-		}(peer)
+			if c.Sent != nil {
+				c.Sent(st.addr, err)
+			}
+			c.broadcasting.Add(-1)
+		}
+		if err != nil && conn != nil {
+			conn.Close()
+			conn = nil
+		}
+
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(StreamIdleTimeout)
+	}
+}
+
+// Wait blocks until every write handed to Broadcast has been sent or has
+// failed, or until ctx is done
+func (c *Client) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for c.broadcasting.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (c *Client) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
 	}
+	return slog.Default()
 }
@@ -0,0 +1,76 @@
+package peer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePeer accepts peer connections, answers the handshake and sends every
+// line received after it to lines
+func fakePeer(t *testing.T, lines chan<- string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				nonce := NewChallenge()
+				for scanner.Scan() {
+					line := scanner.Text()
+					switch {
+					case line == "PEER HELLO":
+						fmt.Fprintln(conn, "CHALLENGE "+nonce)
+					case strings.HasPrefix(line, "PEER AUTH "):
+						fmt.Fprintln(conn, "OK")
+					default:
+						fmt.Fprintln(conn, "OK")
+						lines <- line
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestBroadcastKeepsOrder(t *testing.T) {
+	c := &Client{Secret: "secret"}
+	lines := make(chan string, 1000)
+	addr := fakePeer(t, lines)
+
+	for i := range 500 {
+		c.Broadcast([]string{addr}, fmt.Sprintf("SET k %d", i))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("Broadcast didn't finish: %v", err)
+	}
+	c.Close()
+
+	for i := range 500 {
+		select {
+		case line := <-lines:
+			if want := fmt.Sprintf("SET k %d", i); line != want {
+				t.Fatalf("Expected %q, got %q", want, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Peer got %d of 500 writes", i)
+		}
+	}
+}
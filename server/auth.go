@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+)
+
+var (
+	errAuthRequired = errors.New("authentication required")
+	errNoPerm       = errors.New("no permission")
+)
+
+// authExempt - commands allowed before logging in
+func authExempt(cmd string) bool {
+	switch cmd {
+	case "AUTH", "HELLO", "PEER", "PING", "HEALTH":
+		return true
+	}
+	return false
+}
+
+// authorize - check that u may run cmd with args. Without a registry
+// everyone may run everything.
+func authorize(r *acl.Registry, u *acl.User, cmd string, args []string) error {
+	if r == nil || authExempt(cmd) {
+		return nil
+	}
+	if u == nil {
+		return errAuthRequired
+	}
+	// Anyone may ask who they are and name their connection
+	if cmd == "ACL" && len(args) > 0 && strings.ToUpper(args[0]) == "WHOAMI" {
+		return nil
+	}
+	if cmd == "CLIENT" && len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "ID", "SETNAME", "GETNAME":
+			return nil
+		}
+	}
+
+	if !u.CanRun(cmd) {
+		return fmt.Errorf("%w: user %s can't run %s", errNoPerm, u.Name, cmd)
+	}
+
+	keys, patterns, all := commandKeys(cmd, args)
+	if all && !u.CanAccessAll() {
+		return fmt.Errorf("%w: %s needs access to every key", errNoPerm, cmd)
+	}
+	for _, key := range keys {
+		if !u.CanAccess(key) {
+			return fmt.Errorf("%w: user %s can't access key %s", errNoPerm, u.Name, key)
+		}
+	}
+	for _, pattern := range patterns {
+		if !u.CanAccessPattern(pattern) {
+			return fmt.Errorf("%w: user %s can't access every key matching %s", errNoPerm, u.Name, pattern)
+		}
+	}
+	return nil
+}
+
+// commandKeys - the keys a command touches, the key patterns it watches,
+// and whether it reads the whole keyspace
+func commandKeys(cmd string, args []string) (keys, patterns []string, all bool) {
+	switch cmd {
+	case "SYNC", "CDC", "MONITOR":
+		return nil, nil, true
+	case "SLOWLOG":
+		// The entries show the arguments of commands on any key
+		if len(args) > 0 && strings.ToUpper(args[0]) == "GET" {
+			return nil, nil, true
+		}
+		return nil, nil, false
+	case "WATCHKEYS":
+		return nil, args, false
+	case "BLPOP", "BRPOP":
+		// BLPOP key [key ...] timeout
+		if len(args) > 1 {
+			return args[:len(args)-1], nil, false
+		}
+		return nil, nil, false
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PUBLISH",
+		"UNWATCHKEYS", "STATS", "INFO", "ACL", "PING", "HEALTH", "UNMONITOR", "CLIENT":
+		// Channels are not keys
+		return nil, nil, false
+	}
+	if len(args) > 0 {
+		return args[:1], nil, false
+	}
+	return nil, nil, false
+}
+
+// handleACLCommand - ACL WHOAMI and ACL LIST
+func (srv *Server) handleACLCommand(w io.Writer, u *acl.User, args []string) {
+	r := srv.acl
+	switch {
+	case len(args) == 1 && strings.ToUpper(args[0]) == "WHOAMI":
+		if u == nil {
+			replyValue(w, acl.DefaultUser)
+			return
+		}
+		replyValue(w, u.Name)
+	case len(args) == 1 && strings.ToUpper(args[0]) == "LIST":
+		users := []acl.User{}
+		if r != nil {
+			users = r.Users()
+		}
+		data, _ := json.Marshal(users)
+		replyValue(w, string(data))
+	default:
+		replyError(w, ErrCodeSyntax, "Usage: ACL WHOAMI | ACL LIST")
+	}
+}
+
+func authErrorCode(err error) string {
+	if errors.Is(err, errNoPerm) {
+		return ErrCodeNoPerm
+	}
+	return ErrCodeAuth
+}
+
+// basicAuth - the user logging in with an HTTP style "Basic" authorization
+// value, as sent to the HTTP and gRPC APIs
+func basicAuth(r *acl.Registry, authorization string) (*acl.User, error) {
+	encoded, ok := strings.CutPrefix(authorization, "Basic ")
+	if !ok {
+		return nil, errAuthRequired
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errAuthRequired
+	}
+	name, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, errAuthRequired
+	}
+	return r.Authenticate(name, password)
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+	"github.com/Ahmedhossamdev/simple-kv/kvpb"
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// testUsers - the users of the ACL tests
+func testUsers(t *testing.T) *acl.Registry {
+	hash := func(password string) string {
+		h, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		return string(h)
+	}
+	users, err := acl.New([]acl.User{
+		{Name: "admin", Password: hash("admin-pass"), Commands: []string{"*"}, Keys: []string{"*"}},
+		{Name: "app", Password: hash("app-pass"), Commands: []string{"@read", "@write"}, Keys: []string{"user:*"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	return users
+}
+
+func TestServerAuth(t *testing.T) {
+	go New(store.New(), WithAddr(":9068"), WithACL(testUsers(t)), WithPeerSecret(testSecret)).Start()
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9068")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	send := func(line string) string {
+		fmt.Fprintln(conn, line)
+		response, _ := reader.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+
+	if response := send("HELLO 2"); response != "+HELLO 2" {
+		t.Fatalf("Expected HELLO before AUTH, got: %s", response)
+	}
+	if response := send("GET user:1"); response != "-ERR_AUTH authentication required" {
+		t.Errorf("Expected GET to need a login, got: %s", response)
+	}
+	if response := send("AUTH app wrong"); response != "-ERR_AUTH invalid username or password" {
+		t.Errorf("Unexpected response to a wrong password: %s", response)
+	}
+	if response := send("AUTH app app-pass"); response != "+OK" {
+		t.Fatalf("AUTH failed: %s", response)
+	}
+	if response := send("ACL WHOAMI"); response != "+app" {
+		t.Errorf("Unexpected ACL WHOAMI response: %s", response)
+	}
+
+	if response := send("SET user:1 alice"); response != "+OK" {
+		t.Errorf("Expected app to write user:1, got: %s", response)
+	}
+	if response := send("SET config x"); !strings.HasPrefix(response, "-ERR_NOPERM ") {
+		t.Errorf("Expected app not to write config, got: %s", response)
+	}
+	if response := send("BLPOP user:list other 1"); !strings.HasPrefix(response, "-ERR_NOPERM ") {
+		t.Errorf("Expected BLPOP on a foreign key to be refused, got: %s", response)
+	}
+	if response := send("SYNC"); !strings.HasPrefix(response, "-ERR_NOPERM ") {
+		t.Errorf("Expected app not to dump the database, got: %s", response)
+	}
+	if response := send("WATCHKEYS *"); !strings.HasPrefix(response, "-ERR_NOPERM ") {
+		t.Errorf("Expected app not to watch every key, got: %s", response)
+	}
+	if response := send("ACL LIST"); !strings.HasPrefix(response, "-ERR_NOPERM ") {
+		t.Errorf("Expected app not to list users, got: %s", response)
+	}
+	if response := send("GET user:1|req-id:7"); response != "+alice|req-id:7" {
+		t.Errorf("Unexpected pipelined GET response: %s", response)
+	}
+
+	if response := send("AUTH admin admin-pass"); response != "+OK" {
+		t.Fatalf("AUTH failed: %s", response)
+	}
+	response := send("ACL LIST")
+	if !strings.Contains(response, `"name":"admin"`) || strings.Contains(response, "password") {
+		t.Errorf("Unexpected ACL LIST response: %s", response)
+	}
+
+	// Peers authenticate with the peer handshake instead
+	peerConn, err := (&peer.Client{Secret: testSecret}).Dial("localhost:9068", time.Second)
+	if err != nil {
+		t.Fatalf("Peer handshake failed: %v", err)
+	}
+	defer peerConn.Close()
+	fmt.Fprintln(peerConn, "SYNC")
+	line, _ := bufio.NewReader(peerConn).ReadString('\n')
+	if strings.TrimSpace(line) != "SNAPSHOT:" {
+		t.Errorf("Expected a peer to sync without AUTH, got: %s", line)
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	srv := httptest.NewServer(New(store.New(), WithACL(testUsers(t))).HTTPHandler())
+	defer srv.Close()
+
+	get := func(path, user, password string) int {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		path, user, password string
+		want                 int
+	}{
+		{"/keys/user:1", "", "", http.StatusUnauthorized},
+		{"/keys/user:1", "app", "wrong", http.StatusUnauthorized},
+		{"/keys/user:1", "app", "app-pass", http.StatusNotFound},
+		{"/keys/config", "app", "app-pass", http.StatusForbidden},
+		{"/sync", "app", "app-pass", http.StatusForbidden},
+		{"/sync", "admin", "admin-pass", http.StatusOK},
+	} {
+		if got := get(tc.path, tc.user, tc.password); got != tc.want {
+			t.Errorf("GET %s as %q: status %d, want %d", tc.path, tc.user, got, tc.want)
+		}
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	client := kvpb.NewKVClient(startTestGRPC(t, New(store.New(), WithACL(testUsers(t)))))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Get(ctx, &kvpb.GetRequest{Key: "user:1"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+
+	// "app:app-pass"
+	appCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Basic YXBwOmFwcC1wYXNz")
+	if _, err := client.Get(appCtx, &kvpb.GetRequest{Key: "user:1"}); err != nil {
+		t.Errorf("Expected app to read user:1, got %v", err)
+	}
+	if _, err := client.Set(appCtx, &kvpb.SetRequest{Key: "config", Value: "x"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestKeyRestrictedAdmin(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("ops-pass"), bcrypt.MinCost)
+	users, err := acl.New([]acl.User{
+		{Name: "ops", Password: string(hash), Commands: []string{"@admin"}, Keys: []string{"app:*"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	ops, err := users.Authenticate("ops", "ops-pass")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	// These show the keys and values of every command on the node
+	for _, args := range [][]string{{"MONITOR"}, {"SLOWLOG", "GET"}, {"SYNC"}, {"CDC", "0"}} {
+		if err := authorize(users, ops, args[0], args[1:]); err == nil {
+			t.Errorf("Expected %s to need access to every key", strings.Join(args, " "))
+		}
+	}
+	if err := authorize(users, ops, "SLOWLOG", []string{"LEN"}); err != nil {
+		t.Errorf("Expected SLOWLOG LEN to be allowed, got %v", err)
+	}
+}
+
+func TestACLsNeedPeerSecret(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	srv := New(store.New(), WithListener(l), WithACL(testUsers(t)), WithLogger(discardLogger))
+	if err := srv.Start(); err == nil || !strings.Contains(err.Error(), "peer secret") {
+		t.Fatalf("Expected ACLs without a peer secret to be refused, got %v", err)
+	}
+	// The refused node never started
+	if err := srv.Start(); err == nil || !strings.Contains(err.Error(), "peer secret") {
+		t.Errorf("Expected the same error starting again, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// cdcBatchSize is how many change log entries are read per store call
+const cdcBatchSize = 256
+
+// cdcStream streams the store change log to a client from a given offset.
+// It reads the log at its own pace, so a slow client never holds up writes;
+// if it falls behind the retention limit it gets a truncation error instead.
+type cdcStream struct {
+	conn     net.Conn
+	s        *store.Store
+	mu       sync.Mutex // serialises writes to conn and guards next
+	next     uint64
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// startCDC - parse the CDC arguments and start streaming. Without an offset
+// the stream starts with the next change; offset 0 starts at the oldest
+// retained entry. Offsets are handed out as epoch:seq, and one from another
+// epoch was handed out before the node restarted, so it is refused.
+func startCDC(conn net.Conn, s *store.Store, args []string) *cdcStream {
+	if len(args) > 1 {
+		replyError(conn, ErrCodeSyntax, "Usage: CDC [offset]")
+		return nil
+	}
+
+	offset := s.NextChangeSeq()
+	if len(args) == 1 {
+		seq := args[0]
+		if epoch, rest, ok := strings.Cut(seq, ":"); ok {
+			if current := s.ChangeLogEpoch(); epoch != current {
+				replyError(conn, ErrCodeBadOffset, fmt.Sprintf(
+					"offset is from epoch %s but the node restarted and is at epoch %s, resync and stream from 0", epoch, current))
+				return nil
+			}
+			seq = rest
+		}
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			replyError(conn, ErrCodeSyntax, "offset must be a non-negative integer or epoch:offset")
+			return nil
+		}
+		offset = n
+	}
+
+	entries, _, err := s.ChangesSince(offset, 1)
+	if err != nil {
+		replyStoreError(conn, err)
+		return nil
+	}
+	if offset == 0 {
+		offset = s.NextChangeSeq()
+		if len(entries) > 0 {
+			offset = entries[0].Seq
+		}
+	}
+
+	c := &cdcStream{
+		conn:     conn,
+		s:        s,
+		next:     offset,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	c.reply(frameValue(conn, "streaming from "+formatCDCOffset(s, offset)))
+
+	go c.streamLoop()
+	return c
+}
+
+// streamLoop - write entries as they are appended until stopped
+func (c *cdcStream) streamLoop() {
+	defer close(c.finished)
+
+	for {
+		c.mu.Lock()
+		offset := c.next
+		c.mu.Unlock()
+
+		entries, changed, err := c.s.ChangesSince(offset, cdcBatchSize)
+		if err != nil {
+			c.reply(frameError(c.conn, storeErrorCode(err), err.Error()))
+			return
+		}
+
+		if len(entries) == 0 {
+			select {
+			case <-changed:
+				continue
+			case <-c.done:
+				return
+			}
+		}
+
+		for _, e := range entries {
+			line, _ := json.Marshal(e)
+
+			c.mu.Lock()
+			fmt.Fprintln(c.conn, framePush(c.conn, string(line)))
+			c.next = e.Seq + 1
+			c.mu.Unlock()
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+	}
+}
+
+// reply - write a line without interleaving with streamed entries
+func (c *cdcStream) reply(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintln(c.conn, line)
+}
+
+// stop - end the stream and return the offset to resume from
+func (c *cdcStream) stop() uint64 {
+	close(c.done)
+	<-c.finished
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.next
+}
+
+// formatCDCOffset - the offset as handed out to clients, epoch:seq
+func formatCDCOffset(s *store.Store, seq uint64) string {
+	return fmt.Sprintf("%s:%d", s.ChangeLogEpoch(), seq)
+}
+
+// isCDCStop - true for the only command accepted while streaming
+func isCDCStop(cmd string, args []string) bool {
+	return cmd == "CDC" && len(args) == 1 && strings.ToUpper(args[0]) == "STOP"
+}
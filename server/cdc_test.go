@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerCDC(t *testing.T) {
+	s := store.New()
+
+	go Start(":9046", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9046")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "SET cdc:1 a\n")
+	reader.ReadString('\n')
+
+	// Find the offset of the write above, whichever run this is
+	fmt.Fprintf(conn, "CDC 0\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, _ := reader.ReadString('\n')
+	if !strings.HasPrefix(response, "streaming from ") {
+		t.Fatalf("Unexpected CDC response: %s", response)
+	}
+
+	var last store.ChangeEntry
+	for last.Key != "cdc:1" || last.Value != "a" {
+		response, err = reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected the SET in the change log: %v", err)
+		}
+		json.Unmarshal([]byte(response), &last)
+	}
+
+	// Other commands are rejected while streaming
+	fmt.Fprintf(conn, "GET cdc:1\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "ERROR") {
+		t.Errorf("Expected GET to be rejected while streaming, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "CDC STOP\n")
+	response, _ = reader.ReadString('\n')
+	resume := fmt.Sprintf("%s:%d", last.Epoch, last.Seq+1)
+	if strings.TrimSpace(response) != "stopped "+resume {
+		t.Errorf("Expected to stop after entry %d, got: %s", last.Seq, response)
+	}
+
+	// Resuming from an offset replays everything after it
+	fmt.Fprintf(conn, "SET cdc:1 b\n")
+	reader.ReadString('\n')
+
+	fmt.Fprintf(conn, "CDC %s\n", resume)
+	reader.ReadString('\n')
+	response, _ = reader.ReadString('\n')
+	var entry store.ChangeEntry
+	if err := json.Unmarshal([]byte(response), &entry); err != nil {
+		t.Fatalf("Expected a JSON entry, got: %s", response)
+	}
+	if entry.Seq != last.Seq+1 || entry.Value != "b" {
+		t.Errorf("Unexpected resumed entry: %+v", entry)
+	}
+	fmt.Fprintf(conn, "CDC STOP\n")
+	reader.ReadString('\n')
+
+	// Offsets past the end of the log, or from before a restart, are refused
+	fmt.Fprintf(conn, "CDC %d\n", entry.Seq+2)
+	response, _ = reader.ReadString('\n')
+	if !strings.Contains(response, "beyond the end") {
+		t.Errorf("Expected an offset past the end to be refused, got: %s", response)
+	}
+	fmt.Fprintf(conn, "CDC 0badbeef:%d\n", entry.Seq)
+	response, _ = reader.ReadString('\n')
+	if !strings.Contains(response, "restarted") {
+		t.Errorf("Expected an offset from another epoch to be refused, got: %s", response)
+	}
+
+	// Offsets dropped by retention are reported
+	s.SetChangeLogRetention(1)
+	fmt.Fprintf(conn, "CDC 1\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.Contains(response, "truncated") {
+		t.Errorf("Expected truncation error, got: %s", response)
+	}
+}
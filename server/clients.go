@@ -0,0 +1,265 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// client is the registry entry of one line protocol connection, from a
+// client or a peer
+type client struct {
+	id      int64
+	conn    net.Conn
+	addr    string
+	created time.Time
+
+	lastActive atomic.Int64 // unix nanoseconds of the last command
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+
+	mu      sync.Mutex
+	name    string // set with CLIENT SETNAME
+	lastCmd string
+	user    string // logged in with AUTH
+	peer    bool
+}
+
+// clientInfo describes a connection in CLIENT LIST
+type clientInfo struct {
+	ID          int64  `json:"id"`
+	Addr        string `json:"addr"`
+	Name        string `json:"name"`
+	Type        string `json:"type"` // client or peer
+	User        string `json:"user,omitempty"`
+	AgeSeconds  int64  `json:"age_seconds"`
+	IdleSeconds int64  `json:"idle_seconds"`
+	LastCmd     string `json:"last_cmd"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
+}
+
+func newClient(id int64, conn net.Conn) *client {
+	cl := &client{id: id, conn: conn, addr: conn.RemoteAddr().String(), created: time.Now()}
+	cl.lastActive.Store(cl.created.UnixNano())
+	return cl
+}
+
+// touch - note that the connection sent cmd
+func (cl *client) touch(cmd string) {
+	cl.lastActive.Store(time.Now().UnixNano())
+	cl.mu.Lock()
+	cl.lastCmd = cmd
+	cl.mu.Unlock()
+}
+
+func (cl *client) setName(name string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.name = name
+}
+
+func (cl *client) getName() string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.name
+}
+
+// loggedIn - the connection authenticated as user, or as a peer if user is ""
+func (cl *client) loggedIn(user string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if user == "" {
+		cl.peer = true
+	} else {
+		cl.user = user
+	}
+}
+
+func (cl *client) info(now time.Time) clientInfo {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	in := clientInfo{
+		ID:          cl.id,
+		Addr:        cl.addr,
+		Name:        cl.name,
+		Type:        "client",
+		User:        cl.user,
+		AgeSeconds:  int64(now.Sub(cl.created).Seconds()),
+		IdleSeconds: int64(now.Sub(time.Unix(0, cl.lastActive.Load())).Seconds()),
+		LastCmd:     cl.lastCmd,
+		BytesIn:     cl.bytesIn.Load(),
+		BytesOut:    cl.bytesOut.Load(),
+	}
+	if cl.peer {
+		in.Type = "peer"
+	}
+	return in
+}
+
+// clients - the registry entries of the open connections, oldest first
+func (srv *Server) clients() []*client {
+	srv.mu.Lock()
+	out := make([]*client, 0, len(srv.conns))
+	for _, cl := range srv.conns {
+		out = append(out, cl)
+	}
+	srv.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b *client) int { return cmp.Compare(a.id, b.id) })
+	return out
+}
+
+// killClients - close the connections matching match, returning how many
+func (srv *Server) killClients(by string, match func(*client) bool) int {
+	n := 0
+	for _, cl := range srv.clients() {
+		if match(cl) {
+			srv.logger.Info("client killed", "client", cl.addr, "id", cl.id, "by", by)
+			cl.conn.Close()
+			n++
+		}
+	}
+	return n
+}
+
+// clientPause holds back client commands during CLIENT PAUSE; peers are
+// never paused, so replication keeps flowing
+type clientPause struct {
+	mu     sync.Mutex
+	until  time.Time
+	writes bool          // only writes are held back
+	change chan struct{} // closed when the pause is replaced or lifted
+}
+
+func newClientPause() *clientPause {
+	return &clientPause{change: make(chan struct{})}
+}
+
+// set - pause until then, replacing the current pause; the zero time lifts it
+func (p *clientPause) set(until time.Time, writes bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.until, p.writes = until, writes
+	close(p.change)
+	p.change = make(chan struct{})
+}
+
+// wait - block while cmd is paused or until ctx is done, which is the only
+// error
+func (p *clientPause) wait(ctx context.Context, cmd string) error {
+	switch cmd {
+	case "CLIENT", "PING", "HEALTH":
+		// Probes, and the way out of the pause, keep working
+		return nil
+	}
+
+	for {
+		p.mu.Lock()
+		left, writes, change := time.Until(p.until), p.writes, p.change
+		p.mu.Unlock()
+		if left <= 0 || (writes && !isWrite(cmd)) {
+			return nil
+		}
+
+		t := time.NewTimer(left)
+		select {
+		case <-t.C:
+		case <-change:
+			t.Stop()
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// isWrite - commands CLIENT PAUSE WRITE holds back
+func isWrite(cmd string) bool {
+	switch cmd {
+	case "SET", "DEL", "DELETE", "HSET", "HDEL", "HINCRBY",
+		"LPUSH", "RPUSH", "LPOP", "RPOP", "BLPOP", "BRPOP", "LREMID",
+		"ZADD", "ZREM", "ZINCRBY", "PUBLISH":
+		return true
+	}
+	return false
+}
+
+// handleClient - CLIENT LIST | ID | SETNAME name | GETNAME |
+// KILL addr | KILL ID id | KILL NAME name | PAUSE ms [WRITE|ALL] | UNPAUSE
+func (se *session) handleClient(w io.Writer, args []string) {
+	const usage = "Usage: CLIENT LIST | CLIENT ID | CLIENT SETNAME name | CLIENT GETNAME | " +
+		"CLIENT KILL addr | CLIENT KILL ID id | CLIENT KILL NAME name | CLIENT PAUSE ms [WRITE|ALL] | CLIENT UNPAUSE"
+	if len(args) == 0 {
+		replyError(w, ErrCodeSyntax, usage)
+		return
+	}
+	srv := se.srv
+
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "LIST" && len(args) == 1:
+		now := time.Now()
+		list := []clientInfo{}
+		for _, cl := range srv.clients() {
+			list = append(list, cl.info(now))
+		}
+		out, _ := json.Marshal(list)
+		replyValue(w, string(out))
+	case sub == "ID" && len(args) == 1:
+		replyValue(w, se.client.id)
+	case sub == "SETNAME" && len(args) == 2:
+		se.client.setName(args[1])
+		replyValue(w, "OK")
+	case sub == "GETNAME" && len(args) == 1:
+		if name := se.client.getName(); name != "" {
+			replyValue(w, name)
+		} else {
+			replyNull(w, "No name set")
+		}
+	case sub == "KILL" && len(args) == 2:
+		replyValue(w, srv.killClients(se.client.addr, func(cl *client) bool { return cl.addr == args[1] }))
+	case sub == "KILL" && len(args) == 3 && strings.ToUpper(args[1]) == "ID":
+		id, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			replyError(w, ErrCodeSyntax, usage)
+			return
+		}
+		replyValue(w, srv.killClients(se.client.addr, func(cl *client) bool { return cl.id == id }))
+	case sub == "KILL" && len(args) == 3 && strings.ToUpper(args[1]) == "NAME":
+		replyValue(w, srv.killClients(se.client.addr, func(cl *client) bool { return cl.getName() == args[2] }))
+	case sub == "PAUSE" && (len(args) == 2 || len(args) == 3):
+		ms, err := strconv.Atoi(args[1])
+		if err != nil || ms < 0 {
+			replyError(w, ErrCodeSyntax, usage)
+			return
+		}
+		writes := false
+		if len(args) == 3 {
+			switch strings.ToUpper(args[2]) {
+			case "WRITE":
+				writes = true
+			case "ALL":
+			default:
+				replyError(w, ErrCodeSyntax, usage)
+				return
+			}
+		}
+		srv.pause.set(time.Now().Add(time.Duration(ms)*time.Millisecond), writes)
+		srv.logger.Info("clients paused", "for", time.Duration(ms)*time.Millisecond, "writes_only", writes, "by", se.client.addr)
+		replyValue(w, "OK")
+	case sub == "UNPAUSE" && len(args) == 1:
+		srv.pause.set(time.Time{}, false)
+		srv.logger.Info("clients unpaused", "by", se.client.addr)
+		replyValue(w, "OK")
+	default:
+		replyError(w, ErrCodeSyntax, usage)
+	}
+}
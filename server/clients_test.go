@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/kvpb"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestClientList(t *testing.T) {
+	l := listen(t)
+	startTestServer(t, store.New(), WithListener(l), WithLogger(discardLogger))
+	addr := l.Addr().String()
+
+	admin, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer admin.Close()
+	send := sender(admin)
+
+	other, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer other.Close()
+	sendOther := sender(other)
+
+	if response := send("CLIENT GETNAME"); response != "No name set" {
+		t.Errorf("Expected no name yet, got %s", response)
+	}
+	send("CLIENT SETNAME admin-shell")
+	if response := send("CLIENT GETNAME"); response != "admin-shell" {
+		t.Errorf("Expected the name back, got %s", response)
+	}
+	sendOther("CLIENT SETNAME worker")
+	sendOther("SET job 1")
+	otherID := sendOther("CLIENT ID")
+
+	var list []clientInfo
+	if err := json.Unmarshal([]byte(send("CLIENT LIST")), &list); err != nil {
+		t.Fatalf("Expected JSON: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "admin-shell" || list[1].Name != "worker" {
+		t.Fatalf("Expected both connections, oldest first, got %+v", list)
+	}
+	worker := list[1]
+	if fmt.Sprint(worker.ID) != otherID || worker.Addr != other.LocalAddr().String() || worker.Type != "client" {
+		t.Errorf("Unexpected entry: %+v", worker)
+	}
+	if worker.LastCmd != "CLIENT" || worker.BytesIn == 0 || worker.BytesOut == 0 {
+		t.Errorf("Expected the last command and traffic to be recorded, got %+v", worker)
+	}
+
+	if response := send("CLIENT KILL ID " + otherID); response != "1" {
+		t.Errorf("Expected one connection killed, got %s", response)
+	}
+	other.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := bufio.NewReader(other).ReadString('\n'); err == nil {
+		t.Error("Expected the killed connection to be closed")
+	}
+	waitFor(t, "the killed connection to leave the list", func() bool {
+		return strings.Count(send("CLIENT LIST"), `"id"`) == 1
+	})
+	if response := send("CLIENT KILL NAME nobody"); response != "0" {
+		t.Errorf("Expected nothing killed, got %s", response)
+	}
+	if response := send("CLIENT KILL ID x"); !strings.HasPrefix(response, "Usage: CLIENT") {
+		t.Errorf("Expected a usage error, got %s", response)
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	l := listen(t)
+	startTestServer(t, store.New(), WithListener(l), WithLogger(discardLogger))
+	addr := l.Addr().String()
+
+	admin, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer admin.Close()
+	send := sender(admin)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	send("CLIENT PAUSE 60000 WRITE")
+
+	// Reads go through, writes wait
+	if response := probe(t, addr, "PING"); response != "PONG" {
+		t.Errorf("Expected PING to work while paused, got %s", response)
+	}
+	if response := probe(t, addr, "GET job"); response != "Key not found" {
+		t.Errorf("Expected reads to work while writes are paused, got %s", response)
+	}
+	fmt.Fprintln(conn, "SET job 1")
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Fatal("Expected SET to wait while writes are paused")
+	}
+
+	send("CLIENT UNPAUSE")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if response, _ := reader.ReadString('\n'); strings.TrimSpace(response) != "OK" {
+		t.Errorf("Expected SET to run once unpaused, got %q", response)
+	}
+
+	// A pause ends on its own
+	send("CLIENT PAUSE 100")
+	start := time.Now()
+	if response := probe(t, addr, "GET job"); response != "1" {
+		t.Errorf("Expected the value, got %s", response)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Expected GET to wait for the pause, took %v", waited)
+	}
+}
+
+func TestClientPauseHTTPAndGRPC(t *testing.T) {
+	s := store.New()
+	srv := New(s, WithLogger(discardLogger))
+	httpSrv := httptest.NewServer(srv.HTTPHandler())
+	defer httpSrv.Close()
+	client := kvpb.NewKVClient(startTestGRPC(t, srv))
+
+	srv.pause.set(time.Now().Add(time.Minute), true)
+
+	// Writes wait for the pause, reads don't
+	done := make(chan struct{}, 2)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPut, httpSrv.URL+"/keys/http", strings.NewReader(`{"value": "1"}`))
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		client.Set(context.Background(), &kvpb.SetRequest{Key: "grpc", Value: "1"})
+		done <- struct{}{}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Get(ctx, &kvpb.GetRequest{Key: "grpc"}); err != nil {
+		t.Errorf("Expected reads to work while writes are paused, got %v", err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Expected writes to wait while writes are paused")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, ok := s.Get("http"); ok {
+		t.Error("Expected the HTTP write to wait for the pause")
+	}
+	if _, ok := s.Get("grpc"); ok {
+		t.Error("Expected the gRPC write to wait for the pause")
+	}
+
+	srv.pause.set(time.Time{}, false)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the writes to run once unpaused")
+		}
+	}
+	if _, ok := s.Get("http"); !ok {
+		t.Error("Expected the HTTP write once unpaused")
+	}
+	if _, ok := s.Get("grpc"); !ok {
+		t.Error("Expected the gRPC write once unpaused")
+	}
+}
+
+func TestClientCommandACL(t *testing.T) {
+	l := listen(t)
+	startTestServer(t, store.New(), WithListener(l), WithACL(testUsers(t)), WithPeerSecret(testSecret), WithLogger(discardLogger))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	send := sender(conn)
+	send("AUTH app app-pass")
+
+	// Anyone may name their connection, only admins may see the others
+	if response := send("CLIENT SETNAME app-1"); response != "OK" {
+		t.Errorf("Expected OK, got %s", response)
+	}
+	if response := send("CLIENT LIST"); !strings.Contains(response, "no permission") {
+		t.Errorf("Expected CLIENT LIST to need @admin, got %s", response)
+	}
+	if response := send("CLIENT PAUSE 1000"); !strings.Contains(response, "no permission") {
+		t.Errorf("Expected CLIENT PAUSE to need @admin, got %s", response)
+	}
+}
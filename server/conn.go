@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// bufferedConn batches replies so a pipeline of commands costs one write.
+// The command loop flushes once it has run out of input; lines pushed by
+// other goroutines go through writeNow or pusher, which flush straight away.
+type bufferedConn struct {
+	net.Conn
+	mu    sync.Mutex
+	w     *bufio.Writer
+	proto atomic.Int32 // protocol version chosen with HELLO
+}
+
+// newBufferedConn - buffer the writes to conn, sending them through out,
+// which is conn or a wrapper of it
+func newBufferedConn(conn net.Conn, out io.Writer) *bufferedConn {
+	c := &bufferedConn{Conn: conn, w: bufio.NewWriterSize(out, 32*1024)}
+	c.proto.Store(protoLegacy)
+	return c
+}
+
+func (c *bufferedConn) framed() bool {
+	return c.proto.Load() == protoFramed
+}
+
+func (c *bufferedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.w.Write(p)
+}
+
+// Flush - send everything buffered so far
+func (c *bufferedConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.w.Flush()
+}
+
+// writeNow - write p after anything already buffered and flush
+func (c *bufferedConn) writeNow(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.w.Write(p)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return n, err
+}
+
+// pusher - a view of the connection for streams, where every write flushes
+func (c *bufferedConn) pusher() net.Conn {
+	return pushConn{c}
+}
+
+type pushConn struct {
+	*bufferedConn
+}
+
+func (p pushConn) Write(b []byte) (int, error) {
+	return p.writeNow(b)
+}
+
+// taggedConn collects the reply to a request sent with a req-id so it can
+// be written in one piece, each line tagged with the id
+type taggedConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (t *taggedConn) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+func (t *taggedConn) framed() bool {
+	return isFramed(t.Conn)
+}
+
+// tagged - the collected reply with "|req-id:<id>" appended to every line
+func (t *taggedConn) tagged(reqID string) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(t.buf.Bytes(), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		out.Write(bytes.TrimSuffix(line, []byte("\n")))
+		out.WriteString("|req-id:")
+		out.WriteString(reqID)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// changesMode - commands that switch the connection in or out of a
+// streaming mode, which only make sense in order
+func changesMode(cmd string) bool {
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "WATCHKEYS", "UNWATCHKEYS", "CDC", "MONITOR", "UNMONITOR", "HELLO", "PEER", "AUTH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package server
+
+// matchPattern - Redis-style glob matching used for channel and key patterns
+//
+// Supports * (any run of characters), ? (one character), [abc], [^abc],
+// [a-z] and \ to escape the next character. Unlike path.Match, * also
+// matches '/' so names like "news/sports" behave as expected.
+func matchPattern(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchPattern(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+			name = name[1:]
+			pattern = pattern[1:]
+
+		case '[':
+			if len(name) == 0 {
+				return false
+			}
+			end := 1
+			for end < len(pattern) && pattern[end] != ']' {
+				end++
+			}
+			if end == len(pattern) {
+				// Unterminated class, treat '[' literally
+				if name[0] != '[' {
+					return false
+				}
+				name = name[1:]
+				pattern = pattern[1:]
+				continue
+			}
+			if !matchClass(pattern[1:end], name[0]) {
+				return false
+			}
+			name = name[1:]
+			pattern = pattern[end+1:]
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+			name = name[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(name) == 0
+}
+
+// matchClass - match a single character against the inside of [...]
+func matchClass(class string, c byte) bool {
+	negate := false
+	if len(class) > 0 && class[0] == '^' {
+		negate = true
+		class = class[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= c && c <= class[i+2] {
+				matched = true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == c {
+			matched = true
+		}
+	}
+	return matched != negate
+}
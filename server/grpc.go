@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Ahmedhossamdev/simple-kv/kvpb"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// kvService implements the client facing KV service
+type kvService struct {
+	kvpb.UnimplementedKVServer
+	srv *Server
+}
+
+func (k *kvService) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	if err := k.allowed(ctx, "GET", req.Key); err != nil {
+		return nil, err
+	}
+
+	value, ok := k.srv.store.Get(req.Key)
+	if !ok && k.srv.store.Type(req.Key) != store.TypeNone {
+		return nil, status.Error(codes.FailedPrecondition, store.ErrWrongType.Error())
+	}
+	return &kvpb.GetResponse{Found: ok, Value: value}, nil
+}
+
+func (k *kvService) Set(ctx context.Context, req *kvpb.SetRequest) (*kvpb.SetResponse, error) {
+	if err := k.allowed(ctx, "SET", req.Key); err != nil {
+		return nil, err
+	}
+
+	if err := checkProtocolSafe(req.Key, req.Value); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	k.srv.clientSet(req.Key, req.Value)
+	return &kvpb.SetResponse{}, nil
+}
+
+func (k *kvService) Del(ctx context.Context, req *kvpb.DelRequest) (*kvpb.DelResponse, error) {
+	if err := k.allowed(ctx, "DEL", req.Key); err != nil {
+		return nil, err
+	}
+
+	if err := checkProtocolSafe(req.Key); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	k.srv.clientDel(req.Key)
+	return &kvpb.DelResponse{}, nil
+}
+
+func (k *kvService) Type(ctx context.Context, req *kvpb.TypeRequest) (*kvpb.TypeResponse, error) {
+	if err := k.allowed(ctx, "TYPE", req.Key); err != nil {
+		return nil, err
+	}
+
+	return &kvpb.TypeResponse{Type: k.srv.store.Type(req.Key)}, nil
+}
+
+func (k *kvService) Stats(ctx context.Context, req *kvpb.StatsRequest) (*kvpb.StatsResponse, error) {
+	if err := k.allowed(ctx, "STATS"); err != nil {
+		return nil, err
+	}
+
+	stats := k.srv.store.GetStats()
+	totalKeys, _ := stats["total_keys"].(int)
+	processed, _ := stats["processed_messages"].(int)
+	return &kvpb.StatsResponse{
+		TotalKeys:         int64(totalKeys),
+		ProcessedMessages: int64(processed),
+	}, nil
+}
+
+// Watch - same semantics as WATCHKEYS: events are buffered per stream and
+// a slow client is told how many it missed instead of blocking the store
+func (k *kvService) Watch(req *kvpb.WatchRequest, stream kvpb.KV_WatchServer) error {
+	if err := k.allowed(stream.Context(), "WATCHKEYS", req.Pattern); err != nil {
+		return err
+	}
+
+	events := make(chan store.Event, watcherBufferSize)
+	var dropped atomic.Int64
+
+	cancel := k.srv.store.Watch(func(e store.Event) {
+		if !matchPattern(req.Pattern, e.Key) {
+			return
+		}
+		select {
+		case events <- e:
+		default:
+			dropped.Add(1)
+		}
+	})
+	defer cancel()
+
+	for {
+		select {
+		case e := <-events:
+			err := stream.Send(&kvpb.WatchResponse{Kind: &kvpb.WatchResponse_Event{Event: &kvpb.Event{
+				Key:       e.Key,
+				Op:        e.Op,
+				Timestamp: e.Timestamp,
+				MsgId:     e.MsgID,
+				Origin:    e.Origin,
+			}}})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+
+		if n := dropped.Swap(0); n > 0 {
+			if err := stream.Send(&kvpb.WatchResponse{Kind: &kvpb.WatchResponse_Overflow{Overflow: n}}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcAuthorize - when ACLs are on, log the call in with the Basic
+// credentials in its authorization metadata and check that the user may
+// run cmd with args
+func (srv *Server) grpcAuthorize(ctx context.Context, cmd string, args ...string) error {
+	users := srv.acl
+	if users == nil {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := md.Get("authorization")
+	if len(auth) != 1 {
+		return status.Error(codes.Unauthenticated, errAuthRequired.Error())
+	}
+	u, err := basicAuth(users, auth[0])
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := authorize(users, u, cmd, args); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// allowed - like grpcAuthorize, then hold the call back while CLIENT PAUSE
+// holds back cmd
+func (k *kvService) allowed(ctx context.Context, cmd string, args ...string) error {
+	if err := k.srv.grpcAuthorize(ctx, cmd, args...); err != nil {
+		return err
+	}
+	if err := k.srv.pause.wait(ctx, cmd); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
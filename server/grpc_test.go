@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/Ahmedhossamdev/simple-kv/kvpb"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func startTestGRPC(t *testing.T, srv *Server) *grpc.ClientConn {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	gs := grpc.NewServer()
+	srv.RegisterGRPC(gs)
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCKV(t *testing.T) {
+	s := store.New()
+	client := kvpb.NewKVClient(startTestGRPC(t, New(s)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &kvpb.WatchRequest{Pattern: "user:*"})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond) // let the watch register
+
+	if _, err := client.Set(ctx, &kvpb.SetRequest{Key: "user:1", Value: "alice"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	resp, err := client.Get(ctx, &kvpb.GetRequest{Key: "user:1"})
+	if err != nil || !resp.Found || resp.Value != "alice" {
+		t.Errorf("Unexpected Get response: %v (%v)", resp, err)
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive event: %v", err)
+	}
+	if event.GetEvent().GetKey() != "user:1" || event.GetEvent().GetOp() != store.OpSet {
+		t.Errorf("Unexpected event: %v", event)
+	}
+
+	if _, err := client.Set(ctx, &kvpb.SetRequest{Key: "user:1", Value: "two words"}); err == nil {
+		t.Error("Expected values with spaces to be rejected")
+	}
+
+	client.Del(ctx, &kvpb.DelRequest{Key: "user:1"})
+	resp, _ = client.Get(ctx, &kvpb.GetRequest{Key: "user:1"})
+	if resp.Found {
+		t.Error("Expected user:1 to be deleted")
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// handleHashCommand - handle HSET, HGET, HGETALL, HDEL and HINCRBY
+//
+// Writes are applied locally first and only broadcast when they succeed,
+// so a WRONGTYPE error is never replicated. HINCRBY is replicated as an
+// HSET of the resulting value so peers converge through field-level LWW.
+func (srv *Server) handleHashCommand(conn net.Conn, cmd string, args []string, msgID string, timestamp int64) {
+	s := srv.store
+	replicated := msgID != ""
+	if !replicated {
+		msgID = s.NewMsgID()
+		timestamp = srv.now().UnixNano()
+	}
+
+	switch cmd {
+	case "HSET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			replyError(conn, ErrCodeSyntax, "Usage: HSET key field value [field value ...]")
+			return
+		}
+
+		key := args[0]
+		fields := make(map[string]string)
+		for i := 1; i < len(args); i += 2 {
+			fields[args[i]] = args[i+1]
+		}
+
+		added, err := s.HSet(key, fields, timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("HSET %s|msg-id:%s|ts:%d", strings.Join(args, " "), msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, added)
+
+	case "HGET":
+		if len(args) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: HGET key field")
+			return
+		}
+
+		value, ok, err := s.HGet(args[0], args[1])
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		if ok {
+			replyValue(conn, value)
+		} else {
+			replyNull(conn, "Field not found")
+		}
+
+	case "HGETALL":
+		if len(args) != 1 {
+			replyError(conn, ErrCodeSyntax, "Usage: HGETALL key")
+			return
+		}
+
+		fields, err := s.HGetAll(args[0])
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		fieldsJSON, _ := json.Marshal(fields)
+		replyValue(conn, string(fieldsJSON))
+
+	case "HDEL":
+		if len(args) < 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: HDEL key field [field ...]")
+			return
+		}
+
+		removed, err := s.HDel(args[0], args[1:], timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("HDEL %s|msg-id:%s|ts:%d", strings.Join(args, " "), msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, removed)
+
+	case "HINCRBY":
+		if len(args) != 3 {
+			replyError(conn, ErrCodeSyntax, "Usage: HINCRBY key field increment")
+			return
+		}
+
+		delta, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			replyError(conn, ErrCodeNotInteger, "increment is not an integer")
+			return
+		}
+
+		key, field := args[0], args[1]
+		n, err := s.HIncrBy(key, field, delta, timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("HSET %s %s %d|msg-id:%s|ts:%d", key, field, n, msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, n)
+	}
+}
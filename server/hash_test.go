@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerHashCommands(t *testing.T) {
+	s := store.New()
+
+	go Start(":9025", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9025")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// Start from a clean key in case the server is shared with an earlier run
+	fmt.Fprintf(conn, "DEL user:1\n")
+	reader.ReadString('\n')
+
+	fmt.Fprintf(conn, "HSET user:1 name alice visits 1\n")
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read HSET response: %v", err)
+	}
+	if strings.TrimSpace(response) != "2" {
+		t.Errorf("Expected 2 new fields, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "HINCRBY user:1 visits 4\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "5" {
+		t.Errorf("Expected HINCRBY to return 5, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "HGET user:1 name\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "alice" {
+		t.Errorf("Expected alice, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "HGETALL user:1\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.Contains(response, `"visits":"5"`) {
+		t.Errorf("Expected HGETALL to contain visits, got: %s", response)
+	}
+
+	// String commands against a hash report WRONGTYPE
+	fmt.Fprintf(conn, "GET user:1\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE for GET on a hash, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "HDEL user:1 visits\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "1" {
+		t.Errorf("Expected 1 removed field, got: %s", response)
+	}
+
+	// Bad increments report ERR_NOTINTEGER, out of range results ERR_OVERFLOW
+	fmt.Fprintf(conn, "HELLO 2\n")
+	reader.ReadString('\n')
+	fmt.Fprintf(conn, "HINCRBY user:1 visits abc\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "-ERR_NOTINTEGER") {
+		t.Errorf("Expected ERR_NOTINTEGER for a bad increment, got: %s", response)
+	}
+	fmt.Fprintf(conn, "HSET user:1 visits 9223372036854775807\n")
+	reader.ReadString('\n')
+	fmt.Fprintf(conn, "HINCRBY user:1 visits 1\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "-ERR_OVERFLOW") {
+		t.Errorf("Expected ERR_OVERFLOW, got: %s", response)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+)
+
+// Readiness of a node: it serves from the moment it listens, but only has
+// its peers' data once the startup sync is over
+const (
+	startupSyncPending  = "pending"
+	startupSyncDone     = "done"
+	startupSyncTimedOut = "timed_out"
+)
+
+// health is the reply to HEALTH and GET /readyz
+type health struct {
+	Live        bool   `json:"live"`
+	Ready       bool   `json:"ready"`
+	StartupSync string `json:"startup_sync"` // pending, done or timed_out
+}
+
+// Ready reports whether the node has finished its startup sync with its
+// peers, or given up on it after Settings.ReadyTimeout. A node without
+// peers is ready as soon as it listens; no node is ready once it is
+// shutting down.
+func (srv *Server) Ready() bool {
+	return srv.health().Ready
+}
+
+func (srv *Server) health() health {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return health{
+		Live:        srv.ln != nil && !srv.closing,
+		Ready:       srv.ln != nil && !srv.closing && srv.startupSync != startupSyncPending,
+		StartupSync: srv.startupSync,
+	}
+}
+
+// finishStartupSync - mark the node ready; the first of the sync and the
+// timeout decides how
+func (srv *Server) finishStartupSync(result string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.startupSync != startupSyncPending {
+		return
+	}
+	srv.startupSync = result
+	close(srv.readyc)
+	srv.logger.Info("node ready", "startup_sync", result)
+}
+
+// handleHealth - HEALTH [LIVE|READY]. Without an argument it returns the
+// state as JSON; LIVE and READY answer OK or an error, for probes.
+func (srv *Server) handleHealth(w io.Writer, args []string) {
+	h := srv.health()
+	if len(args) == 0 {
+		out, _ := json.Marshal(h)
+		replyValue(w, string(out))
+		return
+	}
+	if len(args) > 1 {
+		replyError(w, ErrCodeSyntax, "Usage: HEALTH [LIVE|READY]")
+		return
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LIVE":
+		if !h.Live {
+			replyError(w, ErrCodeNotReady, "shutting down")
+			return
+		}
+	case "READY":
+		if !h.Ready {
+			replyError(w, ErrCodeNotReady, "startup sync "+h.StartupSync)
+			return
+		}
+	default:
+		replyError(w, ErrCodeSyntax, "Usage: HEALTH [LIVE|READY]")
+		return
+	}
+	replyValue(w, "OK")
+}
+
+// handlePing - PING [message]
+func handlePing(w io.Writer, args []string) {
+	switch len(args) {
+	case 0:
+		replyValue(w, "PONG")
+	case 1:
+		replyValue(w, args[0])
+	default:
+		replyError(w, ErrCodeSyntax, "Usage: PING [message]")
+	}
+}
+
+// healthHandlers - the probes of the HTTP API: /healthz answers 200 while
+// the node serves, /readyz 200 once it is ready and 503 before
+func (srv *Server) healthHandlers(mux *http.ServeMux) {
+	probe := func(ok func(health) bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h := srv.health()
+			status := http.StatusOK
+			if !ok(h) {
+				status = http.StatusServiceUnavailable
+			}
+			writeJSON(w, status, h)
+		}
+	}
+	mux.Handle("GET /healthz", probe(func(h health) bool { return h.Live }))
+	mux.Handle("GET /readyz", probe(func(h health) bool { return h.Ready }))
+}
+
+// checkPeerHealth - check that a peer answers PING
+func (srv *Server) checkPeerHealth(ctx context.Context, peerAddr string) bool {
+	ctx, cancel := context.WithTimeout(ctx, srv.settings.HealthCheckTimeout)
+	defer cancel()
+
+	var d peer.Dialer = &net.Dialer{}
+	if srv.dialer != nil {
+		d = srv.dialer
+	}
+	conn, err := d.DialContext(ctx, "tcp", peerAddr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if srv.tls != nil {
+		host, _, _ := net.SplitHostPort(peerAddr)
+		tc := tls.Client(conn, srv.tls.ClientConfig(host))
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return false
+		}
+		conn = tc
+	}
+
+	fmt.Fprintln(conn, "PING")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.TrimSpace(line) == "PONG"
+}
+
+// awaitStartupSync - give up waiting for the startup sync after
+// Settings.ReadyTimeout
+func (srv *Server) awaitStartupSync(ctx context.Context) {
+	timer := time.NewTimer(srv.settings.ReadyTimeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		srv.finishStartupSync(startupSyncTimedOut)
+	case <-srv.readyc:
+	case <-ctx.Done():
+	}
+}
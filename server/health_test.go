@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// listen - a listener on a free port
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// probe - send one line to addr and return the reply
+func probe(t *testing.T, addr, line string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, line)
+	response, _ := bufio.NewReader(conn).ReadString('\n')
+	return strings.TrimSpace(response)
+}
+
+// waitFor - poll cond until it holds or a few seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPingAndHealth(t *testing.T) {
+	l := listen(t)
+	srv := startTestServer(t, store.New(), WithListener(l), WithACL(testUsers(t)), WithPeerSecret(testSecret), WithLogger(discardLogger))
+	addr := l.Addr().String()
+
+	// Probes need no login
+	if response := probe(t, addr, "PING"); response != "PONG" {
+		t.Errorf("Expected PONG, got %s", response)
+	}
+	if response := probe(t, addr, "PING hello"); response != "hello" {
+		t.Errorf("Expected the message back, got %s", response)
+	}
+
+	// Without peers a node is ready once it listens
+	waitFor(t, "the node to be ready", srv.Ready)
+	if response := probe(t, addr, "HEALTH READY"); response != "OK" {
+		t.Errorf("Expected OK, got %s", response)
+	}
+	var h health
+	if err := json.Unmarshal([]byte(probe(t, addr, "HEALTH")), &h); err != nil || !h.Live || !h.Ready || h.StartupSync != startupSyncDone {
+		t.Errorf("Unexpected health: %+v (%v)", h, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	if srv.Ready() {
+		t.Error("Expected a node shutting down not to be ready")
+	}
+}
+
+func TestReadinessWaitsForStartupSync(t *testing.T) {
+	// The peer only starts answering once the test starts it
+	lp := listen(t)
+	peerAddr := lp.Addr().String()
+	l := listen(t)
+	srv := startTestServer(t, store.New(), WithListener(l), WithPeers(peerAddr), WithPeerSecret(testSecret), WithLogger(discardLogger),
+		WithSettings(Settings{SyncStartupDelay: 300 * time.Millisecond}))
+	addr := l.Addr().String()
+	waitFor(t, "the node to listen", func() bool { return srv.Addr() != nil })
+
+	if response := probe(t, addr, "HEALTH READY"); response != "ERROR: startup sync pending" {
+		t.Errorf("Expected the node not to be ready, got %s", response)
+	}
+	rec := httptest.NewRecorder()
+	srv.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 from /readyz, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	srv.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 from /healthz, got %d", rec.Code)
+	}
+
+	peerStore := store.New()
+	peerStore.Set("from-peer", "1", 1, "msg-1")
+	startTestServer(t, peerStore, WithListener(lp), WithPeerSecret(testSecret), WithLogger(discardLogger))
+
+	waitFor(t, "the node to be ready", srv.Ready)
+	if srv.health().StartupSync != startupSyncDone {
+		t.Errorf("Expected the startup sync to be done, got %s", srv.health().StartupSync)
+	}
+	// Ready means the peer's data is there
+	if response := probe(t, addr, "GET from-peer"); response != "1" {
+		t.Errorf("Expected the synced key, got %s", response)
+	}
+	rec = httptest.NewRecorder()
+	srv.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 from /readyz, got %d", rec.Code)
+	}
+}
+
+func TestReadinessTimesOut(t *testing.T) {
+	// A peer that accepts connections but never answers
+	silent := listen(t)
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	l := listen(t)
+	srv := startTestServer(t, store.New(), WithListener(l), WithPeers(silent.Addr().String()), WithPeerSecret(testSecret), WithLogger(discardLogger),
+		WithSettings(Settings{SyncStartupDelay: 10 * time.Millisecond, SyncTimeout: time.Minute, ReadyTimeout: 200 * time.Millisecond}))
+
+	waitFor(t, "the node to give up on the startup sync", srv.Ready)
+	if srv.health().StartupSync != startupSyncTimedOut {
+		t.Errorf("Expected the startup sync to time out, got %s", srv.health().StartupSync)
+	}
+
+	// A peer has to answer PING to count as healthy
+	ctx := context.Background()
+	if srv.checkPeerHealth(ctx, silent.Addr().String()) {
+		t.Error("Expected a silent peer to be unhealthy")
+	}
+	if !srv.checkPeerHealth(ctx, l.Addr().String()) {
+		t.Error("Expected a node to be healthy")
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// HTTPHandler returns the HTTP/JSON API, for programs that mount it in
+// their own HTTP server. It shares the store and the peers with the line
+// protocol, so writes made over HTTP are replicated exactly like SET and
+// DEL sent over the line protocol.
+func (srv *Server) HTTPHandler() http.Handler {
+	s := srv.store
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if !srv.httpAllowed(w, r, "GET", key) {
+			return
+		}
+		value, ok := s.Get(key)
+		switch {
+		case ok:
+			writeJSON(w, http.StatusOK, map[string]string{"key": key, "value": value})
+		case s.Type(key) != store.TypeNone:
+			writeJSONError(w, http.StatusConflict, store.ErrWrongType.Error())
+		default:
+			writeJSONError(w, http.StatusNotFound, "Key not found")
+		}
+	})
+
+	mux.HandleFunc("PUT /keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Value *string `json:"value"`
+		}
+		if err := srv.readJSON(r, &body); err != nil || body.Value == nil {
+			writeJSONError(w, http.StatusBadRequest, `body must be {"value": "..."}`)
+			return
+		}
+
+		key := r.PathValue("key")
+		if !srv.httpAllowed(w, r, "SET", key) {
+			return
+		}
+		if err := checkProtocolSafe(key, *body.Value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		srv.clientSet(key, *body.Value)
+		writeJSON(w, http.StatusOK, map[string]string{"result": "OK"})
+	})
+
+	mux.HandleFunc("DELETE /keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if !srv.httpAllowed(w, r, "DEL", key) {
+			return
+		}
+		if err := checkProtocolSafe(key); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		srv.clientDel(key)
+		writeJSON(w, http.StatusOK, map[string]string{"result": "DELETED"})
+	})
+
+	// Batch endpoints: {"keys": [...]} for get and delete,
+	// {"values": {"key": "value", ...}} for set
+	mux.HandleFunc("POST /batch/get", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Keys []string `json:"keys"`
+		}
+		if err := srv.readJSON(r, &body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, `body must be {"keys": [...]}`)
+			return
+		}
+		for _, key := range body.Keys {
+			if !srv.httpAllowed(w, r, "GET", key) {
+				return
+			}
+		}
+
+		values := make(map[string]string)
+		missing := []string{}
+		for _, key := range body.Keys {
+			if value, ok := s.Get(key); ok {
+				values[key] = value
+			} else {
+				missing = append(missing, key)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"values": values, "missing": missing})
+	})
+
+	mux.HandleFunc("POST /batch/set", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Values map[string]string `json:"values"`
+		}
+		if err := srv.readJSON(r, &body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, `body must be {"values": {"key": "value"}}`)
+			return
+		}
+
+		// Validate everything first so a bad entry doesn't leave a partial batch
+		for key, value := range body.Values {
+			if !srv.httpAllowed(w, r, "SET", key) {
+				return
+			}
+			if err := checkProtocolSafe(key, value); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		for key, value := range body.Values {
+			srv.clientSet(key, value)
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"set": len(body.Values)})
+	})
+
+	mux.HandleFunc("POST /batch/delete", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Keys []string `json:"keys"`
+		}
+		if err := srv.readJSON(r, &body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, `body must be {"keys": [...]}`)
+			return
+		}
+
+		for _, key := range body.Keys {
+			if !srv.httpAllowed(w, r, "DEL", key) {
+				return
+			}
+			if err := checkProtocolSafe(key); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		for _, key := range body.Keys {
+			srv.clientDel(key)
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": len(body.Keys)})
+	})
+
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.httpAllowed(w, r, "STATS") {
+			return
+		}
+		writeJSON(w, http.StatusOK, s.GetStats())
+	})
+
+	// GET /sync returns this node's snapshot, POST /sync pulls from peers
+	mux.HandleFunc("GET /sync", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.httpAllowed(w, r, "SYNC") {
+			return
+		}
+		snapshot, err := s.GetSnapshot()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to get snapshot")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(snapshot)
+	})
+
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.httpAllowed(w, r, "SYNC") {
+			return
+		}
+		srv.performSyncWithPeers()
+		writeJSON(w, http.StatusAccepted, map[string]string{"result": "SYNC requested from all peers"})
+	})
+
+	api := srv.withHTTPAuth(mux)
+
+	// Metrics and probes work without logging in; they hold no keys or values
+	root := http.NewServeMux()
+	root.Handle("GET /metrics", srv.MetricsHandler())
+	srv.healthHandlers(root)
+	root.Handle("/", api)
+	return root
+}
+
+type userKey struct{}
+
+// withHTTPAuth - when ACLs are on, log requests in with HTTP Basic auth
+func (srv *Server) withHTTPAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users := srv.acl
+		if users == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		u, err := basicAuth(users, r.Header.Get("Authorization"))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="simple-kv"`)
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+	})
+}
+
+// httpAllowed - check that the user may run cmd with args, answering 403
+// if not, then hold the request back while CLIENT PAUSE holds back cmd
+func (srv *Server) httpAllowed(w http.ResponseWriter, r *http.Request, cmd string, args ...string) bool {
+	u, _ := r.Context().Value(userKey{}).(*acl.User)
+	if err := authorize(srv.acl, u, cmd, args); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, errNoPerm) {
+			status = http.StatusUnauthorized
+		}
+		writeJSONError(w, status, err.Error())
+		return false
+	}
+	if err := srv.pause.wait(r.Context(), cmd); err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return false
+	}
+	return true
+}
+
+// checkProtocolSafe - writes are replicated over the line protocol, which
+// splits on whitespace (any Unicode space, as strings.Fields does) and '|',
+// so such values can't be replicated intact
+func checkProtocolSafe(fields ...string) error {
+	for _, f := range fields {
+		if f == "" {
+			return errors.New("keys and values must not be empty")
+		}
+		if strings.IndexFunc(f, unicode.IsSpace) >= 0 || strings.Contains(f, "|") {
+			return fmt.Errorf("%q contains whitespace or '|', which the replication protocol can't carry", f)
+		}
+	}
+	return nil
+}
+
+func (srv *Server) readJSON(r *http.Request, v interface{}) error {
+	return json.NewDecoder(http.MaxBytesReader(nil, r.Body, srv.settings.MaxHTTPBody)).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
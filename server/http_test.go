@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestHTTPKeys(t *testing.T) {
+	s := store.New()
+	ts := httptest.NewServer(New(s).HTTPHandler())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/keys/name", strings.NewReader(`{"value":"alice"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 from PUT, got %d", resp.StatusCode)
+	}
+
+	if value, ok := s.Get("name"); !ok || value != "alice" {
+		t.Errorf("Expected alice in the store, got %q", value)
+	}
+
+	resp, _ = http.Get(ts.URL + "/keys/name")
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if body["value"] != "alice" {
+		t.Errorf("Unexpected GET body: %v", body)
+	}
+
+	// Values the line protocol can't replicate are rejected
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/keys/name", strings.NewReader(`{"value":"two words"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a value with spaces, got %d", resp.StatusCode)
+	}
+	// Peers split on every Unicode space, not just ASCII ones
+	req, _ = http.NewRequest(http.MethodPut, ts.URL+"/keys/name", strings.NewReader(`{"value":"two\u00a0words"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a value with a no-break space, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, ts.URL+"/keys/name", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	resp, _ = http.Get(ts.URL + "/keys/name")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after DELETE, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPBatch(t *testing.T) {
+	s := store.New()
+	ts := httptest.NewServer(New(s).HTTPHandler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/batch/set", "application/json", strings.NewReader(`{"values":{"a":"1","b":"2"}}`))
+	if err != nil {
+		t.Fatalf("batch set failed: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, _ = http.Post(ts.URL+"/batch/get", "application/json", strings.NewReader(`{"keys":["a","b","c"]}`))
+	var body struct {
+		Values  map[string]string `json:"values"`
+		Missing []string          `json:"missing"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+
+	if body.Values["a"] != "1" || body.Values["b"] != "2" {
+		t.Errorf("Unexpected batch values: %v", body.Values)
+	}
+	if len(body.Missing) != 1 || body.Missing[0] != "c" {
+		t.Errorf("Expected c to be missing, got %v", body.Missing)
+	}
+
+	resp, _ = http.Post(ts.URL+"/batch/delete", "application/json", strings.NewReader(`{"keys":["a"]}`))
+	resp.Body.Close()
+	if _, ok := s.Get("a"); ok {
+		t.Error("Expected a to be deleted")
+	}
+}
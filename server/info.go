@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version is reported by INFO. Release builds set it with
+// -ldflags "-X github.com/Ahmedhossamdev/simple-kv/server.Version=v1.2.3";
+// otherwise the module version from the build info is used.
+var Version = ""
+
+// infoSections are the sections of INFO, in the order they are reported
+var infoSections = []string{"server", "clients", "memory", "stats", "replication", "keyspace"}
+
+// info is the reply to INFO. Every section is an object with fixed field
+// names; sections that weren't asked for are left out.
+type info struct {
+	Server      *infoServer      `json:"server,omitempty"`
+	Clients     *infoClients     `json:"clients,omitempty"`
+	Memory      *infoMemory      `json:"memory,omitempty"`
+	Stats       *infoStats       `json:"stats,omitempty"`
+	Replication *infoReplication `json:"replication,omitempty"`
+	Keyspace    *infoKeyspace    `json:"keyspace,omitempty"`
+}
+
+type infoServer struct {
+	Version       string `json:"version"`
+	GoVersion     string `json:"go_version"`
+	NodeID        string `json:"node_id"`
+	Addr          string `json:"addr"`
+	Started       string `json:"started,omitempty"` // RFC 3339
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+type infoClients struct {
+	Connected int `json:"connected"` // clients and peers
+}
+
+type infoMemory struct {
+	DataBytes      int    `json:"data_bytes"`  // estimated, keys and values
+	DedupBytes     int    `json:"dedup_bytes"` // estimated, msg-id history
+	DedupIDs       int    `json:"dedup_ids"`
+	PubsubDedupIDs int    `json:"pubsub_dedup_ids"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+}
+
+type infoStats struct {
+	CommandsTotal int64            `json:"commands_total"`
+	Commands      map[string]int64 `json:"commands"`
+}
+
+type infoReplication struct {
+	Peers []infoPeer `json:"peers"`
+}
+
+type infoPeer struct {
+	Addr      string `json:"addr"`
+	State     string `json:"state"`                // up, down, or unknown before the first check
+	LastCheck string `json:"last_check,omitempty"` // RFC 3339
+	LastSync  string `json:"last_sync,omitempty"`  // RFC 3339, last successful sync
+}
+
+type infoKeyspace struct {
+	Keys  int            `json:"keys"`
+	Types map[string]int `json:"types"`
+}
+
+// handleInfo - INFO [section ...]
+func (srv *Server) handleInfo(w io.Writer, args []string) {
+	want := make(map[string]bool)
+	for _, arg := range args {
+		section := strings.ToLower(arg)
+		switch {
+		case section == "all" || section == "everything":
+			for _, s := range infoSections {
+				want[s] = true
+			}
+		case slices.Contains(infoSections, section):
+			want[section] = true
+		default:
+			replyError(w, ErrCodeSyntax, fmt.Sprintf("Unknown INFO section %q, expected one of %s", arg, strings.Join(infoSections, ", ")))
+			return
+		}
+	}
+	if len(args) == 0 {
+		for _, s := range infoSections {
+			want[s] = true
+		}
+	}
+
+	out, _ := json.Marshal(srv.info(want))
+	replyValue(w, string(out))
+}
+
+// info - collect the sections in want
+func (srv *Server) info(want map[string]bool) info {
+	var in info
+	now := time.Now()
+
+	if want["server"] {
+		srv.mu.Lock()
+		started := srv.startedAt
+		srv.mu.Unlock()
+
+		in.Server = &infoServer{
+			Version:   version(),
+			GoVersion: runtime.Version(),
+			NodeID:    srv.store.NodeID(),
+		}
+		if a := srv.Addr(); a != nil {
+			in.Server.Addr = a.String()
+		}
+		if !started.IsZero() {
+			in.Server.Started = started.UTC().Format(time.RFC3339)
+			in.Server.UptimeSeconds = int64(now.Sub(started).Seconds())
+		}
+	}
+
+	if want["clients"] {
+		srv.mu.Lock()
+		in.Clients = &infoClients{Connected: len(srv.conns)}
+		srv.mu.Unlock()
+	}
+
+	if want["memory"] || want["keyspace"] {
+		u := srv.store.Usage()
+		if want["memory"] {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			in.Memory = &infoMemory{
+				DataBytes:      u.DataBytes,
+				DedupBytes:     u.DedupBytes,
+				DedupIDs:       u.DedupIDs,
+				PubsubDedupIDs: srv.broker.seen.len(),
+				HeapAllocBytes: ms.HeapAlloc,
+				SysBytes:       ms.Sys,
+			}
+		}
+		if want["keyspace"] {
+			in.Keyspace = &infoKeyspace{Keys: u.Keys, Types: u.Types}
+		}
+	}
+
+	if want["stats"] {
+		counts := srv.metrics.commandCounts()
+		in.Stats = &infoStats{Commands: counts}
+		for _, n := range counts {
+			in.Stats.CommandsTotal += n
+		}
+	}
+
+	if want["replication"] {
+		in.Replication = &infoReplication{Peers: []infoPeer{}}
+		for _, addr := range srv.peerList() {
+			st := srv.peerStates.get(addr)
+			p := infoPeer{Addr: addr, State: "unknown"}
+			if !st.lastCheck.IsZero() {
+				p.State = "down"
+				if st.up {
+					p.State = "up"
+				}
+				p.LastCheck = st.lastCheck.UTC().Format(time.RFC3339)
+			}
+			if !st.lastSync.IsZero() {
+				p.LastSync = st.lastSync.UTC().Format(time.RFC3339)
+			}
+			in.Replication.Peers = append(in.Replication.Peers, p)
+		}
+	}
+	return in
+}
+
+// version - Version, or the module version the binary was built from
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestInfo(t *testing.T) {
+	la, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := down.Addr().String()
+	down.Close()
+
+	fast := WithSettings(Settings{SyncStartupDelay: time.Hour, HealthCheckInterval: 20 * time.Millisecond})
+	s := store.New()
+	s.SetNodeID("node-a")
+	startTestServer(t, s, WithListener(la), WithPeers(lb.Addr().String(), downAddr), WithPeerSecret(testSecret), fast, WithLogger(discardLogger))
+	startTestServer(t, store.New(), WithListener(lb), WithPeerSecret(testSecret), WithLogger(discardLogger))
+
+	conn, err := net.Dial("tcp", la.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	send := func(line string) string {
+		fmt.Fprintln(conn, line)
+		response, _ := reader.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+	send("SET a 1")
+	send("HSET h f v")
+
+	var info map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(send("INFO")), &info); err != nil {
+		t.Fatalf("Expected JSON: %v", err)
+	}
+	for _, section := range infoSections {
+		if info[section] == nil {
+			t.Errorf("Expected the %s section", section)
+		}
+	}
+
+	var server infoServer
+	json.Unmarshal(info["server"], &server)
+	if server.NodeID != "node-a" || server.Version == "" || server.Addr != la.Addr().String() || server.Started == "" {
+		t.Errorf("Unexpected server section: %+v", server)
+	}
+	var stats infoStats
+	json.Unmarshal(info["stats"], &stats)
+	if stats.Commands["SET"] != 1 || stats.Commands["HSET"] != 1 {
+		t.Errorf("Expected the commands to be counted, got %+v", stats)
+	}
+	var keyspace infoKeyspace
+	json.Unmarshal(info["keyspace"], &keyspace)
+	if keyspace.Keys != 2 || keyspace.Types["string"] != 1 || keyspace.Types["hash"] != 1 {
+		t.Errorf("Unexpected keyspace section: %+v", keyspace)
+	}
+	var clients infoClients
+	json.Unmarshal(info["clients"], &clients)
+	if clients.Connected != 1 {
+		t.Errorf("Expected 1 connected client, got %d", clients.Connected)
+	}
+
+	// The recovery monitor finds one peer up, syncs with it, and one down
+	var replication infoReplication
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		replication = infoReplication{}
+		var only map[string]json.RawMessage
+		json.Unmarshal([]byte(send("INFO replication")), &only)
+		if len(only) != 1 {
+			t.Fatalf("Expected only the replication section, got %v", only)
+		}
+		json.Unmarshal(only["replication"], &replication)
+		if len(replication.Peers) == 2 && replication.Peers[0].LastSync != "" && replication.Peers[1].State == "down" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected one peer up and synced and one down, got %+v", replication.Peers)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if replication.Peers[0].State != "up" || replication.Peers[1].LastSync != "" {
+		t.Errorf("Unexpected peers: %+v", replication.Peers)
+	}
+
+	if response := send("INFO bogus"); !strings.Contains(response, "Unknown INFO section") {
+		t.Errorf("Expected an error for an unknown section, got %s", response)
+	}
+}
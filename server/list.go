@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// handleListCommand - handle LPUSH, RPUSH, LPOP, RPOP, BLPOP, BRPOP, LRANGE,
+// LLEN and the internal LREMID replication command. Blocking pops give up
+// when gone is closed.
+//
+// Pushes are replicated as-is with their msg-id, so every node derives the
+// same element IDs. Pops are never replayed on peers; instead the popping
+// node broadcasts LREMID with the ID of the element it removed; each peer
+// gets it after the push that created the element. Concurrent
+// pops on different nodes may therefore both hand out the same element,
+// but a given element is handed out at most once per node.
+func (srv *Server) handleListCommand(conn net.Conn, gone <-chan struct{}, cmd string, args []string, msgID string, timestamp int64) {
+	s := srv.store
+	replicated := msgID != ""
+	if !replicated {
+		msgID = s.NewMsgID()
+		timestamp = srv.now().UnixNano()
+	}
+
+	switch cmd {
+	case "LPUSH", "RPUSH":
+		if len(args) < 2 {
+			replyError(conn, ErrCodeSyntax, fmt.Sprintf("Usage: %s key value [value ...]", cmd))
+			return
+		}
+
+		push := s.RPush
+		if cmd == "LPUSH" {
+			push = s.LPush
+		}
+		length, err := push(args[0], args[1:], timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("%s %s|msg-id:%s|ts:%d", cmd, strings.Join(args, " "), msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, length)
+
+	case "LPOP", "RPOP":
+		if len(args) != 1 {
+			replyError(conn, ErrCodeSyntax, fmt.Sprintf("Usage: %s key", cmd))
+			return
+		}
+
+		pop := s.RPop
+		if cmd == "LPOP" {
+			pop = s.LPop
+		}
+		item, ok, err := pop(args[0], timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		if !ok {
+			replyNull(conn, "Key not found")
+			return
+		}
+
+		if !replicated {
+			srv.broadcastListRemoval(args[0], item, msgID, timestamp)
+		}
+		replyValue(conn, item.Data)
+
+	case "BLPOP", "BRPOP":
+		if len(args) < 2 {
+			replyError(conn, ErrCodeSyntax, fmt.Sprintf("Usage: %s key [key ...] timeout", cmd))
+			return
+		}
+
+		seconds, err := strconv.ParseFloat(args[len(args)-1], 64)
+		if err != nil || seconds < 0 {
+			replyError(conn, ErrCodeSyntax, "timeout is not a valid number of seconds")
+			return
+		}
+		srv.handleBlockingPop(conn, gone, args[:len(args)-1], cmd == "BLPOP", seconds, msgID)
+
+	case "LRANGE":
+		if len(args) != 3 {
+			replyError(conn, ErrCodeSyntax, "Usage: LRANGE key start stop")
+			return
+		}
+
+		start, err1 := strconv.Atoi(args[1])
+		stop, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			replyError(conn, ErrCodeSyntax, "start and stop must be integers")
+			return
+		}
+
+		values, err := s.LRange(args[0], start, stop)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		valuesJSON, _ := json.Marshal(values)
+		replyValue(conn, string(valuesJSON))
+
+	case "LLEN":
+		if len(args) != 1 {
+			replyError(conn, ErrCodeSyntax, "Usage: LLEN key")
+			return
+		}
+
+		length, err := s.LLen(args[0])
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		replyValue(conn, length)
+
+	case "LREMID":
+		// Only accepted from peers, as the replicated form of a pop
+		if !replicated || len(args) < 2 {
+			replyError(conn, ErrCodeUnknownCommand, "Unknown command: "+cmd)
+			return
+		}
+
+		if err := s.LRemIDs(args[0], args[1:], timestamp, msgID); err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		replyValue(conn, "OK")
+	}
+}
+
+// handleBlockingPop - park the connection until one of keys has an element
+// or the timeout elapses. A timeout of zero blocks until the server shuts
+// down. Once gone is closed nobody is left to hand an element to, so it
+// stops waiting without popping.
+func (srv *Server) handleBlockingPop(conn net.Conn, gone <-chan struct{}, keys []string, left bool, seconds float64, msgID string) {
+	s := srv.store
+	var timeout <-chan time.Time
+	if seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case <-gone:
+			return
+		default:
+		}
+
+		timestamp := srv.now().UnixNano()
+		key, item, wait, err := s.PopOrWait(keys, left, timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if wait == nil {
+			srv.broadcastListRemoval(key, item, msgID, timestamp)
+			replyValue(conn, key+" "+item.Data)
+			return
+		}
+
+		select {
+		case <-wait:
+			// Something was pushed, try again
+		case <-timeout:
+			s.CancelWait(keys, wait)
+			replyNull(conn, "Timeout")
+			return
+		case <-srv.ctx.Done():
+			s.CancelWait(keys, wait)
+			replyNull(conn, "Timeout")
+			return
+		case <-gone:
+			s.CancelWait(keys, wait)
+			return
+		}
+	}
+}
+
+// broadcastListRemoval - replicate a pop as the removal of a specific element
+func (srv *Server) broadcastListRemoval(key string, item store.ListItem, msgID string, timestamp int64) {
+	line := fmt.Sprintf("LREMID %s %s|msg-id:%s|ts:%d", key, item.ID, msgID, timestamp)
+	srv.broadcast(line)
+}
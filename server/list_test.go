@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerListCommands(t *testing.T) {
+	s := store.New()
+
+	go Start(":9028", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9028")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// Start from a clean key in case the server is shared with an earlier run
+	fmt.Fprintf(conn, "DEL jobs\n")
+	reader.ReadString('\n')
+
+	fmt.Fprintf(conn, "RPUSH jobs a b c\n")
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read RPUSH response: %v", err)
+	}
+	if strings.TrimSpace(response) != "3" {
+		t.Errorf("Expected length 3, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "LRANGE jobs 0 -1\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != `["a","b","c"]` {
+		t.Errorf("Unexpected LRANGE response: %s", response)
+	}
+
+	fmt.Fprintf(conn, "LPOP jobs\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "a" {
+		t.Errorf("Expected a, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "LLEN jobs\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "2" {
+		t.Errorf("Expected length 2, got: %s", response)
+	}
+}
+
+func TestServerBlockingPop(t *testing.T) {
+	s := store.New()
+
+	go Start(":9031", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	worker, err := net.Dial("tcp", "localhost:9031")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer worker.Close()
+
+	producer, err := net.Dial("tcp", "localhost:9031")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer producer.Close()
+
+	workerReader := bufio.NewReader(worker)
+	producerReader := bufio.NewReader(producer)
+
+	// Times out when nothing arrives
+	fmt.Fprintf(worker, "BLPOP empty 0.1\n")
+	response, _ := workerReader.ReadString('\n')
+	if strings.TrimSpace(response) != "Timeout" {
+		t.Errorf("Expected Timeout, got: %s", response)
+	}
+
+	// Wakes up when a producer pushes
+	fmt.Fprintf(worker, "BRPOP queue 5\n")
+	time.Sleep(100 * time.Millisecond)
+
+	fmt.Fprintf(producer, "LPUSH queue job1\n")
+	producerReader.ReadString('\n')
+
+	worker.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err = workerReader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read BRPOP response: %v", err)
+	}
+	if strings.TrimSpace(response) != "queue job1" {
+		t.Errorf("Expected 'queue job1', got: %s", response)
+	}
+}
+
+func TestServerBlockingPopGivesUpOnHangUp(t *testing.T) {
+	s := store.New()
+
+	go Start(":9032", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	producer, err := net.Dial("tcp", "localhost:9032")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer producer.Close()
+	producerReader := bufio.NewReader(producer)
+
+	// One worker hangs up, the other is killed while blocked
+	hungUp, err := net.Dial("tcp", "localhost:9032")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	fmt.Fprintf(hungUp, "BLPOP jobs 0\n")
+
+	killed, err := net.Dial("tcp", "localhost:9032")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer killed.Close()
+	fmt.Fprintf(killed, "CLIENT SETNAME doomed\nBLPOP jobs 0\n")
+
+	time.Sleep(100 * time.Millisecond)
+	hungUp.Close()
+	fmt.Fprintf(producer, "CLIENT KILL NAME doomed\n")
+	producerReader.ReadString('\n')
+	time.Sleep(100 * time.Millisecond)
+
+	fmt.Fprintf(producer, "RPUSH jobs x y\n")
+	producerReader.ReadString('\n')
+	time.Sleep(100 * time.Millisecond)
+
+	fmt.Fprintf(producer, "LLEN jobs\n")
+	response, _ := producerReader.ReadString('\n')
+	if strings.TrimSpace(response) != "2" {
+		t.Errorf("Expected both jobs to stay queued, got LLEN %s", response)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loggedArgs are the arguments of a command as they appear in the log.
+// Values are left out unless the node logs them (WithLogValues), keeping
+// only the keys; secrets are never logged.
+type loggedArgs struct {
+	cmd    string
+	args   []string
+	values bool
+}
+
+// LogValue implements slog.LogValuer, so the arguments are only formatted
+// when the record is actually written
+func (a loggedArgs) LogValue() slog.Value {
+	switch {
+	case a.cmd == "AUTH", a.cmd == "PEER", a.cmd == "ACL":
+		// Passwords and handshake responses; keep the subcommand only
+		if len(a.args) == 0 || a.cmd == "AUTH" {
+			return slog.StringValue(redacted(len(a.args)))
+		}
+		return slog.StringValue(strings.TrimSpace(strings.ToUpper(a.args[0]) + " " + redacted(len(a.args)-1)))
+	case a.values:
+		return slog.StringValue(strings.Join(a.args, " "))
+	}
+
+	keys, patterns, _ := commandKeys(a.cmd, a.args)
+	// keys may share the args' backing array, so appending to it would
+	// overwrite the command being logged
+	shown := append(append([]string(nil), keys...), patterns...)
+	if len(shown) > len(a.args) {
+		shown = shown[:len(a.args)]
+	}
+	if hidden := len(a.args) - len(shown); hidden > 0 {
+		shown = append(shown, redacted(hidden))
+	}
+	return slog.StringValue(strings.Join(shown, " "))
+}
+
+// redacted - the placeholder for n arguments left out of the log
+func redacted(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return "[" + strconv.Itoa(n) + " redacted]"
+}
+
+// execute - run one command, record how long it took and log it
+func (se *session) execute(conn net.Conn, cmd string, cmdParts []string, msgID string, timestamp int64) {
+	source := "client"
+	if se.peer {
+		source = "peer"
+	}
+	remote := se.conn.RemoteAddr().String()
+
+	// Peers aren't paused, so replication keeps flowing
+	if !se.peer {
+		se.srv.pause.wait(se.srv.ctx, cmd)
+	}
+
+	start := time.Now()
+	// A monitor doesn't see its own UNMONITOR
+	if se.monitor == nil {
+		se.srv.monitors.feed(source, remote, cmd, cmdParts[1:], start)
+	}
+	se.dispatch(conn, cmd, cmdParts, msgID, timestamp)
+	took := time.Since(start)
+	se.srv.metrics.observeCommand(cmd, se.peer, took)
+
+	// Blocking pops are slow by design; waiting isn't what the slow log is for
+	if cmd != "BLPOP" && cmd != "BRPOP" {
+		se.srv.recordSlow(source, remote, cmd, cmdParts[1:], start, took)
+	}
+
+	logger := se.srv.logger
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	logger.Debug("command",
+		"cmd", cmd,
+		"args", loggedArgs{cmd: cmd, args: cmdParts[1:], values: se.srv.logValues},
+		source, remote,
+		"latency", took)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// logBuffer collects log output written from several goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records - the JSON records logged with msg
+func (b *logBuffer) records(t *testing.T, msg string) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Expected JSON log lines, got %q", line)
+		}
+		if r["msg"] == msg {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// runLogged - send lines to a node logging at debug level and return the
+// logged commands
+func runLogged(t *testing.T, logValues bool, lines ...string) []map[string]any {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &logBuffer{}
+	logger := slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := store.New()
+	s.SetNodeID("node-a")
+	srv := startTestServer(t, s, WithListener(l), WithLogger(logger), WithLogValues(logValues))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for _, line := range lines {
+		fmt.Fprintln(conn, line)
+		reader.ReadString('\n')
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	return logs.records(t, "command")
+}
+
+func TestCommandLogRedactsValues(t *testing.T) {
+	records := runLogged(t, false, "SET user:1 s3cret", "AUTH admin hunter2")
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 logged commands, got %d", len(records))
+	}
+
+	set := records[0]
+	if set["cmd"] != "SET" || set["args"] != "user:1 [1 redacted]" {
+		t.Errorf("Expected the key without the value, got %v", set)
+	}
+	if set["node_id"] != "node-a" {
+		t.Errorf("Expected the node ID, got %v", set["node_id"])
+	}
+	if _, ok := set["latency"]; !ok {
+		t.Error("Expected the latency to be logged")
+	}
+	if _, ok := set["client"]; !ok {
+		t.Error("Expected the client address to be logged")
+	}
+
+	if auth := records[1]; auth["args"] != "[2 redacted]" {
+		t.Errorf("Expected AUTH to be redacted, got %v", auth["args"])
+	}
+}
+
+func TestCommandLogValues(t *testing.T) {
+	records := runLogged(t, true, "SET user:1 s3cret", "AUTH admin hunter2")
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 logged commands, got %d", len(records))
+	}
+	if records[0]["args"] != "user:1 s3cret" {
+		t.Errorf("Expected the value to be logged, got %v", records[0]["args"])
+	}
+	if records[1]["args"] != "[2 redacted]" {
+		t.Errorf("Expected AUTH to stay redacted, got %v", records[1]["args"])
+	}
+}
+
+func TestCommandLogLeavesArgsAlone(t *testing.T) {
+	args := []string{"user:1", "s3cret"}
+	if got := (loggedArgs{cmd: "SET", args: args}).LogValue().String(); got != "user:1 [1 redacted]" {
+		t.Errorf("Expected the key without the value, got %s", got)
+	}
+	if args[1] != "s3cret" {
+		t.Errorf("Expected the command's arguments to be left alone, got %v", args)
+	}
+}
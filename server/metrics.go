@@ -0,0 +1,213 @@
+package server
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// knownCommands label the command metrics; anything else a client sends is
+// counted as "unknown" so clients can't create series at will
+var knownCommands = map[string]bool{
+	"SET": true, "DEL": true, "DELETE": true, "GET": true, "TYPE": true,
+	"HSET": true, "HGET": true, "HGETALL": true, "HDEL": true, "HINCRBY": true,
+	"LPUSH": true, "RPUSH": true, "LPOP": true, "RPOP": true, "BLPOP": true, "BRPOP": true,
+	"LRANGE": true, "LLEN": true, "LREMID": true,
+	"ZADD": true, "ZREM": true, "ZSCORE": true, "ZRANK": true, "ZRANGE": true, "ZRANGEBYSCORE": true, "ZINCRBY": true,
+	"SYNC": true, "SUBSCRIBE": true, "PSUBSCRIBE": true, "UNSUBSCRIBE": true, "PUNSUBSCRIBE": true, "PUBLISH": true,
+	"WATCHKEYS": true, "UNWATCHKEYS": true, "CDC": true, "PEER": true, "AUTH": true, "ACL": true, "HELLO": true,
+	"STATS": true, "INFO": true, "PING": true, "HEALTH": true, "SLOWLOG": true,
+	"MONITOR": true, "UNMONITOR": true, "CLIENT": true,
+}
+
+// metrics are the Prometheus metrics of one node. Each node has its own
+// registry, so several nodes can run in one process.
+type metrics struct {
+	registry *prometheus.Registry
+
+	commands    *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	connections prometheus.Gauge
+	bytesIn     prometheus.Counter
+	bytesOut    prometheus.Counter
+
+	replicated   *prometheus.CounterVec
+	syncs        *prometheus.CounterVec
+	syncDuration *prometheus.HistogramVec
+	syncBytes    prometheus.Histogram
+
+	// Commands run by name, for INFO
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newMetrics(srv *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		counts:   make(map[string]int64),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simplekv_commands_total",
+			Help: "Commands processed, by command and by whether a client or a peer sent them.",
+		}, []string{"cmd", "source"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "simplekv_command_duration_seconds",
+			Help:    "Time taken to run a command.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to 2.6s
+		}, []string{"cmd"}),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "simplekv_connections",
+			Help: "Open line protocol connections, from clients and peers.",
+		}),
+		bytesIn: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "simplekv_net_input_bytes_total",
+			Help: "Bytes read from line protocol connections.",
+		}),
+		bytesOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "simplekv_net_output_bytes_total",
+			Help: "Bytes written to line protocol connections.",
+		}),
+		replicated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simplekv_replication_messages_total",
+			Help: "Writes replicated to peers, by peer and result (sent or failed).",
+		}, []string{"peer", "result"}),
+		syncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simplekv_syncs_total",
+			Help: "Snapshot syncs with peers, by peer and result (ok or failed).",
+		}, []string{"peer", "result"}),
+		syncDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "simplekv_sync_duration_seconds",
+			Help:    "Time taken to fetch and merge a peer's snapshot.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8), // 1ms to 16s
+		}, []string{"peer"}),
+		syncBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "simplekv_sync_snapshot_bytes",
+			Help:    "Size of the snapshots received from peers.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 10), // 1KiB to 256MiB
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.commands, m.latency, m.connections, m.bytesIn, m.bytesOut,
+		m.replicated, m.syncs, m.syncDuration, m.syncBytes,
+		&storeCollector{srv: srv},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// observeCommand - count one command and how long it took
+func (m *metrics) observeCommand(cmd string, peer bool, took time.Duration) {
+	if !knownCommands[cmd] {
+		cmd = "unknown"
+	}
+	source := "client"
+	if peer {
+		source = "peer"
+	}
+	m.commands.WithLabelValues(cmd, source).Inc()
+	m.mu.Lock()
+	m.counts[cmd]++
+	m.mu.Unlock()
+	m.latency.WithLabelValues(cmd).Observe(took.Seconds())
+}
+
+// commandCounts - how many times each command ran
+func (m *metrics) commandCounts() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.counts)
+}
+
+// observeReplication - count a write sent to a peer; used as peer.Client.Sent
+func (m *metrics) observeReplication(peer string, err error) {
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	m.replicated.WithLabelValues(peer, result).Inc()
+}
+
+// observeSync - count a sync with a peer and, when it worked, its cost
+func (m *metrics) observeSync(peer string, took time.Duration, size int, err error) {
+	if err != nil {
+		m.syncs.WithLabelValues(peer, "failed").Inc()
+		return
+	}
+	m.syncs.WithLabelValues(peer, "ok").Inc()
+	m.syncDuration.WithLabelValues(peer).Observe(took.Seconds())
+	m.syncBytes.Observe(float64(size))
+}
+
+// storeCollector reports the size of the store, measured on every scrape
+type storeCollector struct {
+	srv *Server
+}
+
+var (
+	keysDesc = prometheus.NewDesc("simplekv_keys",
+		"Keys in the store.", nil, nil)
+	dedupDesc = prometheus.NewDesc("simplekv_dedup_ids",
+		"msg-ids remembered to drop duplicate deliveries, by where (store or pubsub).", []string{"map"}, nil)
+	storeBytesDesc = prometheus.NewDesc("simplekv_store_bytes",
+		"Estimated memory used by the store, by part (data or dedup).", []string{"part"}, nil)
+)
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- keysDesc
+	ch <- dedupDesc
+	ch <- storeBytesDesc
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	u := c.srv.store.Usage()
+	ch <- prometheus.MustNewConstMetric(keysDesc, prometheus.GaugeValue, float64(u.Keys))
+	ch <- prometheus.MustNewConstMetric(dedupDesc, prometheus.GaugeValue, float64(u.DedupIDs), "store")
+	ch <- prometheus.MustNewConstMetric(dedupDesc, prometheus.GaugeValue, float64(c.srv.broker.seen.len()), "pubsub")
+	ch <- prometheus.MustNewConstMetric(storeBytesDesc, prometheus.GaugeValue, float64(u.DataBytes), "data")
+	ch <- prometheus.MustNewConstMetric(storeBytesDesc, prometheus.GaugeValue, float64(u.DedupBytes), "dedup")
+}
+
+// MetricsHandler returns the Prometheus metrics of the node, for programs
+// that serve them from their own HTTP server. The HTTP API serves them on
+// /metrics.
+func (srv *Server) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(srv.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// countingReader counts the bytes read through it, for the node and for
+// the connection
+type countingReader struct {
+	r     io.Reader
+	n     prometheus.Counter
+	total *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(float64(n))
+	c.total.Add(int64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written through it, for the node and for
+// the connection
+type countingWriter struct {
+	w     io.Writer
+	n     prometheus.Counter
+	total *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(float64(n))
+	c.total.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A peer that is down, so replication fails
+	down, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := down.Addr().String()
+	down.Close()
+
+	srv := startTestServer(t, store.New(), WithListener(l), WithPeers(downAddr),
+		WithACL(testUsers(t)), WithPeerSecret(testSecret), WithLogger(discardLogger))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for _, line := range []string{"AUTH admin admin-pass", "SET a 1", "SET b 2", "GET a", "FLY away"} {
+		fmt.Fprintln(conn, line)
+		reader.ReadString('\n')
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.client.Wait(ctx); err != nil {
+		t.Fatalf("Replication did not finish: %v", err)
+	}
+
+	// Scraping needs no login, even with ACLs on
+	rec := httptest.NewRecorder()
+	srv.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`simplekv_commands_total{cmd="SET",source="client"} 2`,
+		`simplekv_commands_total{cmd="GET",source="client"} 1`,
+		`simplekv_commands_total{cmd="unknown",source="client"} 1`,
+		`simplekv_command_duration_seconds_count{cmd="SET"} 2`,
+		`simplekv_connections 1`,
+		`simplekv_keys 2`,
+		`simplekv_dedup_ids{map="store"} 2`,
+		fmt.Sprintf(`simplekv_replication_messages_total{peer=%q,result="failed"} 2`, downAddr),
+		`simplekv_store_bytes{part="data"}`,
+		`go_memstats_heap_alloc_bytes`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in the metrics", want)
+		}
+	}
+	if strings.Contains(body, "FLY") {
+		t.Error("Expected unknown commands not to get their own series")
+	}
+	for _, name := range []string{"simplekv_net_input_bytes_total", "simplekv_net_output_bytes_total"} {
+		if strings.Contains(body, name+" 0\n") || !strings.Contains(body, name) {
+			t.Errorf("Expected %s to count the traffic", name)
+		}
+	}
+}
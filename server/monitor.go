@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBufferSize is how many commands may queue up for a MONITOR
+// connection before it is considered too slow and disconnected
+const monitorBufferSize = 4096
+
+// monitor is a connection in MONITOR mode. Like a subscriber it has its own
+// writer, and it is dropped rather than allowed to slow the node down.
+type monitor struct {
+	conn     net.Conn
+	logger   *slog.Logger
+	out      chan string
+	done     chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
+}
+
+// monitors are the connections in MONITOR mode on this node
+type monitors struct {
+	mu    sync.RWMutex
+	set   map[*monitor]bool
+	count atomic.Int32 // len(set), read without the lock on every command
+}
+
+func newMonitors() *monitors {
+	return &monitors{set: make(map[*monitor]bool)}
+}
+
+// start - put conn in MONITOR mode
+func (ms *monitors) start(conn net.Conn, logger *slog.Logger) *monitor {
+	m := &monitor{
+		conn:     conn,
+		logger:   logger,
+		out:      make(chan string, monitorBufferSize),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	m.send(frameValue(conn, "OK"))
+	go m.writeLoop()
+
+	ms.mu.Lock()
+	ms.set[m] = true
+	ms.count.Store(int32(len(ms.set)))
+	ms.mu.Unlock()
+	return m
+}
+
+// stop - take m out of MONITOR mode, flushing what it has queued
+func (ms *monitors) stop(m *monitor) {
+	ms.mu.Lock()
+	delete(ms.set, m)
+	ms.count.Store(int32(len(ms.set)))
+	ms.mu.Unlock()
+
+	m.stopOnce.Do(func() { close(m.done) })
+	<-m.finished
+}
+
+// feed - show a command to every monitor:
+//
+//	1736000000.123456 [client 10.0.0.7:51234] SET user:1 alice
+//
+// source is client or peer, from is the address the command came from
+func (ms *monitors) feed(source, from, cmd string, args []string, at time.Time) {
+	if ms.count.Load() == 0 {
+		return
+	}
+
+	shown, redacted := hideSecrets(cmd, args)
+	line := fmt.Sprintf("%d.%06d [%s %s] %s", at.Unix(), at.Nanosecond()/1000, source, from, cmd)
+	if len(shown) > 0 {
+		line += " " + strings.Join(shown, " ")
+	}
+	if redacted {
+		line += " [redacted]"
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	for m := range ms.set {
+		m.send(framePush(m.conn, line))
+	}
+}
+
+// writeLoop - drain queued lines to the connection
+func (m *monitor) writeLoop() {
+	defer close(m.finished)
+
+	for {
+		select {
+		case line := <-m.out:
+			if _, err := fmt.Fprintln(m.conn, line); err != nil {
+				m.close()
+				return
+			}
+		case <-m.done:
+			for {
+				select {
+				case line := <-m.out:
+					fmt.Fprintln(m.conn, line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send - queue a line, disconnecting the monitor if it can't keep up
+func (m *monitor) send(line string) {
+	select {
+	case m.out <- line:
+	case <-m.done:
+	default:
+		m.logger.Warn("disconnecting slow monitor", "client", m.conn.RemoteAddr().String())
+		m.close()
+	}
+}
+
+// close - drop the connection; the session then stops the monitor
+func (m *monitor) close() {
+	m.conn.Close()
+	m.stopOnce.Do(func() { close(m.done) })
+}
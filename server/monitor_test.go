@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestMonitor(t *testing.T) {
+	l := listen(t)
+	startTestServer(t, store.New(), WithListener(l), WithPeerSecret(testSecret), WithLogger(discardLogger))
+	addr := l.Addr().String()
+
+	mon, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer mon.Close()
+	monReader := bufio.NewReader(mon)
+	next := func() string {
+		mon.SetReadDeadline(time.Now().Add(2 * time.Second))
+		line, err := monReader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected a monitor line: %v", err)
+		}
+		return strings.TrimSpace(line)
+	}
+
+	fmt.Fprintln(mon, "MONITOR")
+	if response := next(); response != "OK" {
+		t.Fatalf("Expected OK, got %s", response)
+	}
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	send := sender(client)
+	send("SET user:1 alice")
+	send("AUTH admin hunter2")
+
+	peerConn, err := (&peer.Client{Secret: testSecret}).Dial(addr, time.Second)
+	if err != nil {
+		t.Fatalf("Peer handshake failed: %v", err)
+	}
+	defer peerConn.Close()
+	fmt.Fprintf(peerConn, "DEL user:1|msg-id:m-1|ts:%d\n", time.Now().UnixNano())
+	bufio.NewReader(peerConn).ReadString('\n')
+
+	from := regexp.QuoteMeta(client.LocalAddr().String())
+	expect := []*regexp.Regexp{
+		regexp.MustCompile(`^\d+\.\d{6} \[client ` + from + `\] SET user:1 alice$`),
+		regexp.MustCompile(`^\d+\.\d{6} \[client ` + from + `\] AUTH \[redacted\]$`),
+		// The handshake runs before the connection counts as a peer
+		regexp.MustCompile(`^\d+\.\d{6} \[client [^\]]+\] PEER HELLO$`),
+		regexp.MustCompile(`^\d+\.\d{6} \[client [^\]]+\] PEER AUTH \[redacted\]$`),
+		regexp.MustCompile(`^\d+\.\d{6} \[peer [^\]]+\] DEL user:1$`),
+	}
+	for _, re := range expect {
+		if line := next(); !re.MatchString(line) {
+			t.Errorf("Expected a line matching %s, got %s", re, line)
+		}
+	}
+
+	// Nothing but UNMONITOR while monitoring
+	fmt.Fprintln(mon, "GET user:1")
+	if response := next(); response != "ERROR: GET is not allowed while monitoring" {
+		t.Errorf("Expected a state error, got %s", response)
+	}
+	fmt.Fprintln(mon, "UNMONITOR")
+	if response := next(); response != "OK" {
+		t.Errorf("Expected OK, got %s", response)
+	}
+	fmt.Fprintln(mon, "GET user:1")
+	if response := next(); response != "Key not found" {
+		t.Errorf("Expected the connection to be usable again, got %s", response)
+	}
+}
+
+func TestSlowMonitorDisconnected(t *testing.T) {
+	// Writes to a pipe block until the other end reads
+	local, remote := net.Pipe()
+	defer remote.Close()
+	ms := newMonitors()
+	m := ms.start(local, discardLogger)
+
+	for i := 0; i < monitorBufferSize+10; i++ {
+		ms.feed("client", "test", "SET", []string{"k", "v"}, time.Now())
+	}
+
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, remote); err != nil {
+		t.Fatalf("Expected the slow monitor to be disconnected: %v", err)
+	}
+	ms.stop(m)
+	if n := ms.count.Load(); n != 0 {
+		t.Errorf("Expected no monitors left, got %d", n)
+	}
+}
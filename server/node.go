@@ -0,0 +1,502 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+	"github.com/Ahmedhossamdev/simple-kv/certs"
+	"github.com/Ahmedhossamdev/simple-kv/kvpb"
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// ErrServerClosed is returned by Server.Start after Shutdown
+var ErrServerClosed = errors.New("server: server closed")
+
+// Server is one simple-kv node: the line protocol listener, the optional
+// HTTP and gRPC APIs, and the background sync and persistence loops that
+// go with them. Every Server has its own configuration, so several nodes
+// can run in one process.
+type Server struct {
+	store *store.Store
+
+	addr, httpAddr, grpcAddr string
+	listener                 net.Listener // set with WithListener
+
+	peers      PeerProvider
+	peerSecret string
+	dialer     peer.Dialer
+	client     *peer.Client
+
+	tls          *certs.Reloader
+	acl          *acl.Registry
+	settings     Settings
+	dataDir      string
+	saveInterval time.Duration
+	logger       *slog.Logger
+	logValues    bool
+	now          func() time.Time
+
+	broker     *broker
+	metrics    *metrics
+	peerStates *peerStates
+	slowLog    *slowLog
+	monitors   *monitors
+	pause      *clientPause
+
+	mu        sync.Mutex
+	started   bool
+	startedAt time.Time
+	// startupSync is pending until the first sync with the peers is over;
+	// readyc is closed then
+	startupSync string
+	readyc      chan struct{}
+	closing     bool
+	ln          net.Listener
+	conns       map[net.Conn]*client
+	lastID      int64 // of the last connection registered
+	httpSrv     *http.Server
+	grpcSrv     *grpc.Server
+
+	// ctx is cancelled on Shutdown; it stops the background loops and
+	// wakes up blocked commands
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	handlers   sync.WaitGroup // connections being served
+	background sync.WaitGroup // sync, monitoring and persistence loops
+}
+
+// New returns a node serving s, configured by opts. Without options it
+// serves the line protocol on :8080 with no peers.
+func New(s *store.Store, opts ...Option) *Server {
+	srv := &Server{
+		store:    s,
+		addr:     ":8080",
+		peers:    StaticPeers(nil),
+		settings: defaultSettings,
+		logger:   slog.Default(),
+		now:      time.Now,
+		conns:    make(map[net.Conn]*client),
+
+		startupSync: startupSyncPending,
+		readyc:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	// msg-ids created on this node carry its ID so peers know the origin
+	if srv.store.NodeID() == "" {
+		addr := srv.addr
+		if srv.listener != nil {
+			addr = srv.listener.Addr().String()
+		}
+		srv.store.SetNodeID(defaultNodeID(addr))
+	}
+	srv.logger = srv.logger.With("node_id", srv.store.NodeID())
+
+	srv.broker = newBroker(srv.logger)
+	srv.metrics = newMetrics(srv)
+	srv.peerStates = newPeerStates()
+	srv.slowLog = newSlowLog(srv.settings.SlowLogMaxLen)
+	srv.monitors = newMonitors()
+	srv.pause = newClientPause()
+	srv.client = &peer.Client{
+		Secret:  srv.peerSecret,
+		TLS:     srv.tls,
+		Timeout: srv.settings.PeerDialTimeout,
+		Dialer:  srv.dialer,
+		Logger:  srv.logger,
+		Sent:    srv.metrics.observeReplication,
+	}
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	return srv
+}
+
+// Start listens on the configured addresses and serves until Shutdown, after
+// which it returns ErrServerClosed. Any other error means the node could not
+// start.
+func (srv *Server) Start() error {
+	if err := srv.validate(); err != nil {
+		return err
+	}
+
+	srv.mu.Lock()
+	if srv.started {
+		srv.mu.Unlock()
+		return errors.New("server: already started")
+	}
+	srv.started = true
+	srv.mu.Unlock()
+
+	// A node that fails before it is listening, say on a busy port or a bad
+	// snapshot, stays unstarted so Start can be tried again
+	listening := false
+	defer func() {
+		if !listening {
+			srv.mu.Lock()
+			srv.started = false
+			srv.mu.Unlock()
+		}
+	}()
+
+	if srv.dataDir != "" {
+		if err := loadSnapshot(srv.store, srv.dataDir); err != nil {
+			return err
+		}
+	}
+
+	l := srv.listener
+	if l == nil {
+		var err error
+		if l, err = net.Listen("tcp", srv.addr); err != nil {
+			return err
+		}
+	}
+	// The HTTP and gRPC listeners serve TLS with the same certificates
+	var tlsConfig *tls.Config
+	if srv.tls != nil {
+		tlsConfig = srv.tls.ServerConfig()
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	var httpL, grpcL net.Listener
+	var err error
+	if srv.httpAddr != "" {
+		if httpL, err = net.Listen("tcp", srv.httpAddr); err != nil {
+			l.Close()
+			return err
+		}
+	}
+	if srv.grpcAddr != "" {
+		if grpcL, err = net.Listen("tcp", srv.grpcAddr); err != nil {
+			l.Close()
+			if httpL != nil {
+				httpL.Close()
+			}
+			return err
+		}
+	}
+
+	srv.mu.Lock()
+	if srv.closing {
+		srv.mu.Unlock()
+		l.Close()
+		if httpL != nil {
+			httpL.Close()
+		}
+		if grpcL != nil {
+			grpcL.Close()
+		}
+		return ErrServerClosed
+	}
+	srv.ln = l
+	listening = true
+	srv.startedAt = time.Now()
+	if httpL != nil {
+		srv.httpSrv = &http.Server{Handler: srv.HTTPHandler(), TLSConfig: tlsConfig}
+		if tlsConfig != nil {
+			httpL = tls.NewListener(httpL, tlsConfig)
+		}
+	}
+	if grpcL != nil {
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		srv.grpcSrv = grpc.NewServer(opts...)
+		srv.RegisterGRPC(srv.grpcSrv)
+	}
+	// Holding the group open until Start returns lets the loops below join
+	// it without racing Shutdown's wait
+	srv.background.Add(1)
+	defer srv.background.Done()
+	srv.mu.Unlock()
+
+	if httpL != nil {
+		srv.goBackground(func() {
+			if err := srv.httpSrv.Serve(httpL); err != http.ErrServerClosed {
+				srv.logger.Error("HTTP server stopped", "err", err)
+			}
+		})
+	}
+	if grpcL != nil {
+		srv.goBackground(func() {
+			if err := srv.grpcSrv.Serve(grpcL); err != nil {
+				srv.logger.Error("gRPC server stopped", "err", err)
+			}
+		})
+	}
+	if srv.dataDir != "" {
+		srv.goBackground(func() {
+			srv.persist(srv.ctx)
+		})
+	}
+
+	srv.logger.Info("node started", "addr", l.Addr().String(), "http_addr", srv.httpAddr, "grpc_addr", srv.grpcAddr,
+		"peers", len(srv.peerList()), "tls", srv.tls != nil)
+
+	// Start automatic sync services; a provider's peers may show up later
+	if _, static := srv.peers.(StaticPeers); static && len(srv.peerList()) == 0 {
+		srv.finishStartupSync(startupSyncDone)
+	} else {
+		// Startup sync - sync when node starts
+		srv.goBackground(func() {
+			select {
+			case <-time.After(srv.settings.SyncStartupDelay): // Wait for server to be ready
+			case <-srv.ctx.Done():
+				return
+			}
+			srv.performStartupSync(srv.ctx)
+			if srv.ctx.Err() == nil {
+				srv.finishStartupSync(startupSyncDone)
+			}
+		})
+
+		// Don't stay unready forever when peers don't answer
+		srv.goBackground(func() {
+			srv.awaitStartupSync(srv.ctx)
+		})
+
+		// Periodic sync - the first one runs one interval after startup
+		srv.goBackground(func() {
+			srv.startPeriodicSync(srv.ctx)
+		})
+
+		// Peer recovery monitor - detect when peers come back online
+		srv.goBackground(func() {
+			srv.startPeerRecoveryMonitor(srv.ctx)
+		})
+	}
+
+	var backoff time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// Out of file descriptors and the like; wait for it to pass
+			backoff = min(max(2*backoff, 5*time.Millisecond), time.Second)
+			srv.logger.Warn("accept failed", "err", err, "retry_in", backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		cl := srv.track(conn)
+		if cl == nil {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer srv.untrack(conn)
+			srv.handleConnection(cl)
+		}()
+	}
+}
+
+// Run starts the server and, once ctx is done, shuts it down gracefully
+// within Settings.ShutdownTimeout. It returns nil after a clean shutdown.
+func (srv *Server) Run(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), srv.settings.ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	<-errc
+	return err
+}
+
+// validate - check the settings and the options that can't work together
+func (srv *Server) validate() error {
+	if err := srv.settings.validate(); err != nil {
+		return err
+	}
+	// Peers skip the ACLs, so a node anyone can peer with has none
+	if srv.acl != nil && srv.peerSecret == "" {
+		return errors.New("server: ACLs need a peer secret (WithPeerSecret)")
+	}
+	// Writes would never reach peers that can't authenticate
+	if _, static := srv.peers.(StaticPeers); (!static || len(srv.peerList()) > 0) && !srv.peerAuthOn() {
+		return errors.New("server: peers need a peer secret (WithPeerSecret) or mutual TLS")
+	}
+	return nil
+}
+
+// Shutdown stops the server gracefully: it stops accepting connections,
+// lets every connection finish the commands it has already sent, waits
+// for writes still being replicated to peers and saves a last snapshot to
+// the data dir. If ctx is done first, the remaining connections are closed
+// and ctx's error is returned once the snapshot is saved.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	if srv.closing {
+		srv.mu.Unlock()
+		return ErrServerClosed
+	}
+	srv.closing = true
+	srv.cancel()
+	started := srv.ln != nil
+	if started {
+		srv.ln.Close()
+
+		// Sessions read whatever is buffered, run it, flush and hang up
+		for conn := range srv.conns {
+			conn.SetReadDeadline(time.Now())
+		}
+	}
+	srv.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	var errs []error
+	if srv.httpSrv != nil {
+		errs = append(errs, srv.httpSrv.Shutdown(ctx))
+	}
+	if srv.grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			srv.grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			srv.grpcSrv.Stop()
+		}
+	}
+
+	if err := waitGroup(ctx, &srv.handlers); err != nil {
+		srv.mu.Lock()
+		for conn := range srv.conns {
+			conn.Close()
+		}
+		srv.mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	// Writes accepted above are only durable once peers have them
+	errs = append(errs, srv.client.Wait(ctx))
+	srv.client.Close()
+	errs = append(errs, waitGroup(ctx, &srv.background))
+
+	if srv.dataDir != "" {
+		path := filepath.Join(srv.dataDir, snapshotFile)
+		if err := srv.store.SaveFile(path); err != nil {
+			errs = append(errs, fmt.Errorf("saving snapshot: %w", err))
+		} else {
+			srv.logger.Info("saved final snapshot", "path", path)
+		}
+	}
+
+	// A timeout shows up once per step it interrupted; report it once
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Addr returns the address the line protocol is served on, or nil before
+// Start has listened
+func (srv *Server) Addr() net.Addr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.ln == nil {
+		return nil
+	}
+	return srv.ln.Addr()
+}
+
+// RegisterGRPC registers the KV service on gs, for programs that run their
+// own gRPC server
+func (srv *Server) RegisterGRPC(gs *grpc.Server) {
+	kvpb.RegisterKVServer(gs, &kvService{srv: srv})
+}
+
+func (srv *Server) shuttingDown() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closing
+}
+
+// track - register a new connection, unless the server is shutting down
+func (srv *Server) track(conn net.Conn) *client {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closing {
+		return nil
+	}
+	srv.lastID++
+	cl := newClient(srv.lastID, conn)
+	srv.conns[conn] = cl
+	srv.handlers.Add(1)
+	return cl
+}
+
+func (srv *Server) untrack(conn net.Conn) {
+	srv.mu.Lock()
+	delete(srv.conns, conn)
+	srv.mu.Unlock()
+	srv.handlers.Done()
+}
+
+func (srv *Server) goBackground(f func()) {
+	srv.background.Add(1)
+	go func() {
+		defer srv.background.Done()
+		f()
+	}()
+}
+
+// peerList - the current peers
+func (srv *Server) peerList() []string {
+	return srv.peers.Peers()
+}
+
+// broadcast - replicate line to every peer
+func (srv *Server) broadcast(line string) {
+	srv.client.Broadcast(srv.peerList(), line)
+}
+
+// waitGroup - wait for wg, giving up when ctx is done
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
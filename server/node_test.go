@@ -0,0 +1,295 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// testSecret is the peer secret of test clusters
+const testSecret = "test-secret"
+
+// startTestServer - start a node and shut it down when the test ends
+func startTestServer(t *testing.T, s *store.Store, opts ...Option) *Server {
+	srv := New(s, opts...)
+	go srv.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return srv
+}
+
+// sender - send a line on conn and return the one-line reply
+func sender(conn net.Conn) func(line string) string {
+	reader := bufio.NewReader(conn)
+	return func(line string) string {
+		fmt.Fprintln(conn, line)
+		response, _ := reader.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	dir := t.TempDir()
+	srv := New(store.New(), WithAddr(":9073"), WithHTTPAddr(":9074"), WithDataDir(dir, time.Minute))
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start() }()
+	time.Sleep(200 * time.Millisecond)
+
+	// A client blocked without a timeout is released by the shutdown
+	blocked, err := net.Dial("tcp", "localhost:9073")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer blocked.Close()
+	fmt.Fprintf(blocked, "BLPOP jobs 0\n")
+
+	// Commands already sent are all answered before the connection closes
+	conn, err := net.Dial("tcp", "localhost:9073")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	var batch strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&batch, "SET key%d %d\n", i, i)
+	}
+	fmt.Fprint(conn, batch.String())
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	replies := 0
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if scanner.Text() != "OK" {
+			t.Errorf("Expected OK, got: %s", scanner.Text())
+		}
+		replies++
+	}
+	if replies != 100 {
+		t.Errorf("Expected 100 replies before the connection closed, got %d", replies)
+	}
+
+	response, _ := bufio.NewReader(blocked).ReadString('\n')
+	if strings.TrimSpace(response) != "Timeout" {
+		t.Errorf("Expected the blocked BLPOP to time out, got: %q", response)
+	}
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Expected ErrServerClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after Shutdown")
+	}
+
+	if _, err := net.Dial("tcp", "localhost:9073"); err == nil {
+		t.Error("Expected the listener to be closed")
+	}
+	if _, err := http.Get("http://localhost:9074/keys/key1"); err == nil {
+		t.Error("Expected the HTTP listener to be closed")
+	}
+
+	// The final snapshot has every write
+	restored := store.New()
+	if err := restored.LoadFile(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatalf("Failed to load the final snapshot: %v", err)
+	}
+	if value, ok := restored.Get("key99"); !ok || value != "99" {
+		t.Errorf("Expected key99 in the snapshot, got %q", value)
+	}
+
+	if err := srv.Shutdown(ctx); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected a second Shutdown to report ErrServerClosed, got %v", err)
+	}
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	srv := New(store.New(), WithAddr(":9075"))
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := srv.Start(); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+	if _, err := net.Dial("tcp", "localhost:9075"); err == nil {
+		t.Error("Expected nothing to listen")
+	}
+}
+
+func TestStartRefusesBadSettings(t *testing.T) {
+	srv := New(store.New(), WithAddr(":9079"), WithSettings(Settings{MaxInFlight: -1}), WithLogger(discardLogger))
+	if err := srv.Start(); err == nil || !strings.Contains(err.Error(), "MaxInFlight") {
+		t.Fatalf("Expected a negative MaxInFlight to be refused, got %v", err)
+	}
+}
+
+func TestStartRetryAfterFailure(t *testing.T) {
+	busy := listen(t)
+	srv := New(store.New(), WithAddr(busy.Addr().String()), WithLogger(discardLogger))
+	if err := srv.Start(); err == nil {
+		t.Fatal("Expected Start on a busy port to fail")
+	}
+
+	// Once the port is free the same node starts
+	busy.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start() }()
+	waitFor(t, "the node to listen", func() bool { return srv.Addr() != nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-errc; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestSyncLargeSnapshot(t *testing.T) {
+	l := listen(t)
+	big := store.New()
+	fields := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		fields[fmt.Sprintf("field-%d", i)] = "value"
+	}
+	big.HSet("big", fields, time.Now().UnixNano(), big.NewMsgID())
+	startTestServer(t, big, WithListener(l), WithPeerSecret(testSecret), WithLogger(discardLogger))
+
+	s := store.New()
+	srv := New(s, WithPeerSecret(testSecret), WithLogger(discardLogger))
+	if err := srv.syncWithPeer(context.Background(), l.Addr().String()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got, _ := s.HGetAll("big"); len(got) != len(fields) {
+		t.Errorf("Expected %d fields after the sync, got %d", len(fields), len(got))
+	}
+}
+
+// testPeers is a peer list that changes while the node runs
+type testPeers struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (p *testPeers) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.addrs
+}
+
+func (p *testPeers) set(addrs ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addrs = addrs
+}
+
+// countingDialer counts the connections it opens
+type countingDialer struct {
+	net.Dialer
+	dials atomic.Int64
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dials.Add(1)
+	return d.Dialer.DialContext(ctx, network, addr)
+}
+
+func TestServerOptions(t *testing.T) {
+	l1, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two nodes in one process, each with its own configuration
+	peers := &testPeers{}
+	dialer := &countingDialer{}
+	at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	s1, s2 := store.New(), store.New()
+	srv1 := startTestServer(t, s1, WithListener(l1), WithPeerProvider(peers), WithDialer(dialer),
+		WithPeerSecret("secret"), WithClock(func() time.Time { return at }), WithLogger(discardLogger))
+	startTestServer(t, s2, WithListener(l2), WithPeerSecret("secret"), WithLogger(discardLogger))
+
+	var timestamps []int64
+	var mu sync.Mutex
+	s1.Watch(func(e store.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		timestamps = append(timestamps, e.Timestamp)
+	})
+
+	conn, err := net.Dial("tcp", l1.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	send := func(line string) string {
+		fmt.Fprintln(conn, line)
+		response, _ := reader.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+
+	// Writes go to whoever the provider lists at the time
+	send("SET before-peers 1")
+	peers.set(l2.Addr().String())
+	send("SET after-peers 1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv1.client.Wait(ctx); err != nil {
+		t.Fatalf("Replication did not finish: %v", err)
+	}
+	if _, ok := s2.Get("before-peers"); ok {
+		t.Error("Expected the write made without peers to stay local")
+	}
+	if value, ok := s2.Get("after-peers"); !ok || value != "1" {
+		t.Errorf("Expected the write to reach the new peer, got %q", value)
+	}
+	if dialer.dials.Load() == 0 {
+		t.Error("Expected the injected dialer to be used")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(timestamps) != 2 {
+		t.Errorf("Expected 2 write events, got %d", len(timestamps))
+	}
+	for _, ts := range timestamps {
+		if ts != at.UnixNano() {
+			t.Errorf("Expected writes to be stamped by the injected clock, got %d", ts)
+		}
+	}
+	if srv1.Addr().String() != l1.Addr().String() {
+		t.Errorf("Expected Addr to report the listener, got %s", srv1.Addr())
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/acl"
+	"github.com/Ahmedhossamdev/simple-kv/certs"
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+)
+
+// Option configures a Server, see New
+type Option func(*Server)
+
+// PeerProvider tells a node who its peers are. It is asked again for every
+// write and sync, so the membership may change while the node runs.
+type PeerProvider interface {
+	Peers() []string
+}
+
+// StaticPeers is a fixed list of peer addresses
+type StaticPeers []string
+
+// Peers returns the list itself
+func (p StaticPeers) Peers() []string {
+	return p
+}
+
+// WithAddr sets the line protocol address; the default is ":8080"
+func WithAddr(addr string) Option {
+	return func(srv *Server) { srv.addr = addr }
+}
+
+// WithListener serves the line protocol on l instead of listening on the
+// address set with WithAddr. The server closes l on Shutdown.
+func WithListener(l net.Listener) Option {
+	return func(srv *Server) { srv.listener = l }
+}
+
+// WithHTTPAddr serves the HTTP/JSON API on addr next to the line protocol
+func WithHTTPAddr(addr string) Option {
+	return func(srv *Server) { srv.httpAddr = addr }
+}
+
+// WithGRPCAddr serves the KV and Peer gRPC services on addr next to the
+// line protocol
+func WithGRPCAddr(addr string) Option {
+	return func(srv *Server) { srv.grpcAddr = addr }
+}
+
+// WithPeers replicates writes to a fixed list of peers
+func WithPeers(addrs ...string) Option {
+	return func(srv *Server) { srv.peers = StaticPeers(addrs) }
+}
+
+// WithPeerProvider replicates writes to the peers p returns at the time
+func WithPeerProvider(p PeerProvider) Option {
+	return func(srv *Server) { srv.peers = p }
+}
+
+// WithPeerSecret sets the shared secret peers authenticate each other with.
+// Every node of a cluster must use the same secret. Without one, peers can
+// only authenticate with mutual TLS.
+func WithPeerSecret(secret string) Option {
+	return func(srv *Server) { srv.peerSecret = secret }
+}
+
+// WithDialer opens connections to peers with d instead of a net.Dialer
+func WithDialer(d peer.Dialer) Option {
+	return func(srv *Server) { srv.dialer = d }
+}
+
+// WithTLS serves TLS with r's certificates and connects to peers over TLS.
+// When r has a CA, peers must also present a certificate signed by it
+// before PEER AUTH succeeds.
+func WithTLS(r *certs.Reloader) Option {
+	return func(srv *Server) { srv.tls = r }
+}
+
+// WithACL makes clients log in with one of the users in r and restricts
+// them to the commands and keys their user allows. Authenticated peers are
+// not subject to ACLs.
+func WithACL(r *acl.Registry) Option {
+	return func(srv *Server) { srv.acl = r }
+}
+
+// WithSettings changes the tunables; zero fields keep their defaults
+func WithSettings(st Settings) Option {
+	return func(srv *Server) { srv.settings = st.withDefaults() }
+}
+
+// WithDataDir restores a snapshot from dir on Start, saves one every
+// interval in which something changed and a last one on Shutdown
+func WithDataDir(dir string, interval time.Duration) Option {
+	return func(srv *Server) {
+		srv.dataDir = dir
+		srv.saveInterval = interval
+	}
+}
+
+// WithLogger logs to l instead of slog.Default(). Every command is logged
+// at debug level, with its keys but not its values.
+func WithLogger(l *slog.Logger) Option {
+	return func(srv *Server) { srv.logger = l }
+}
+
+// WithLogValues logs the values of commands as well as their keys.
+// Passwords and peer handshakes are never logged.
+func WithLogValues(on bool) Option {
+	return func(srv *Server) { srv.logValues = on }
+}
+
+// WithClock takes the timestamps of client writes from now instead of
+// time.Now; tests use it to order writes deterministically
+func WithClock(now func() time.Time) Option {
+	return func(srv *Server) { srv.now = now }
+}
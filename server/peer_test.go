@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerPeerAuthentication(t *testing.T) {
+	const secret = "test-secret"
+	startTestServer(t, store.New(), WithAddr(":9061"), WithPeers("localhost:9062"), WithPeerSecret(secret))
+	startTestServer(t, store.New(), WithAddr(":9062"), WithPeers("localhost:9061"), WithPeerSecret(secret))
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9061")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	conn2, err := net.Dial("tcp", "localhost:9062")
+	if err != nil {
+		t.Fatalf("Failed to connect to node 2: %v", err)
+	}
+	defer conn2.Close()
+	reader2 := bufio.NewReader(conn2)
+
+	send := func(line string) string {
+		fmt.Fprintln(conn, line)
+		response, _ := reader.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+	send2 := func(line string) string {
+		fmt.Fprintln(conn2, line)
+		response, _ := reader2.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+
+	// A client can't pass itself off as a peer
+	send("PEER HELLO")
+	if response := send("PEER AUTH 00"); response != "ERROR: peer authentication failed" {
+		t.Errorf("Unexpected PEER AUTH response: %s", response)
+	}
+	if response := send("PEER AUTH 00"); response != "ERROR: peer authentication failed" {
+		t.Errorf("Expected a fresh challenge to be required, got: %s", response)
+	}
+
+	// Metadata sent by a client is ignored: the write gets a fresh timestamp
+	// and is replicated like any other client write
+	send("DEL forged")
+	send(fmt.Sprintf("SET forged v1|msg-id:forged-%d|ts:99999999999999999", time.Now().UnixNano()))
+	time.Sleep(200 * time.Millisecond)
+	if response := send2("GET forged"); response != "v1" {
+		t.Errorf("Expected client write to replicate, got: %s", response)
+	}
+	send("SET forged v2")
+	if response := send("GET forged"); response != "v2" {
+		t.Errorf("Expected a later write to win, got: %s", response)
+	}
+
+	// An authenticated peer's metadata is honoured and not re-broadcast
+	peerConn, err := (&peer.Client{Secret: secret}).Dial("localhost:9061", time.Second)
+	if err != nil {
+		t.Fatalf("Peer handshake failed: %v", err)
+	}
+	defer peerConn.Close()
+	peerReader := bufio.NewReader(peerConn)
+
+	send2("SET replicated old")
+	time.Sleep(200 * time.Millisecond)
+	fmt.Fprintf(peerConn, "SET replicated new|msg-id:peer-%d|ts:%d\n", time.Now().UnixNano(), time.Now().UnixNano())
+	peerReader.ReadString('\n')
+	if response := send("GET replicated"); response != "new" {
+		t.Errorf("Expected replicated write to apply, got: %s", response)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if response := send2("GET replicated"); response != "old" {
+		t.Errorf("Replicated write was broadcast again: %s", response)
+	}
+
+	// A node with a different secret is turned away
+	nonce, _ := strings.CutPrefix(send("PEER HELLO"), "CHALLENGE ")
+	response := (&peer.Client{Secret: "other-secret"}).Sign(nonce)
+	if response := send("PEER AUTH " + response); response != "ERROR: peer authentication failed" {
+		t.Errorf("Expected handshake with the wrong secret to fail, got: %s", response)
+	}
+}
+
+func TestPeersNeedPeerAuth(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	srv := New(store.New(), WithListener(l), WithPeers("localhost:1"), WithLogger(discardLogger))
+	if err := srv.Start(); err == nil || !strings.Contains(err.Error(), "peer secret") {
+		t.Fatalf("Expected peers without a peer secret to be refused, got %v", err)
+	}
+}
+
+func TestStartNeedsPeerSecret(t *testing.T) {
+	t.Setenv("SIMPLE_KV_PEER_SECRET", "")
+	if err := Start(":9078", store.New(), []string{"localhost:1"}); err == nil || !strings.Contains(err.Error(), "peer secret") {
+		t.Fatalf("Expected Start with peers and no secret to fail, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// peerState is what a node knows about one of its peers
+type peerState struct {
+	up        bool
+	lastCheck time.Time // zero until the recovery monitor has checked it
+	lastSync  time.Time // zero until a sync with it succeeded
+}
+
+// peerStates tracks the health checks and syncs of every peer
+type peerStates struct {
+	mu    sync.Mutex
+	peers map[string]*peerState
+}
+
+func newPeerStates() *peerStates {
+	return &peerStates{peers: make(map[string]*peerState)}
+}
+
+func (p *peerStates) entry(addr string) *peerState {
+	st, ok := p.peers[addr]
+	if !ok {
+		st = &peerState{}
+		p.peers[addr] = st
+	}
+	return st
+}
+
+// checked - record a health check and return whether the peer was up
+// before it; peers not checked yet count as down
+func (p *peerStates) checked(addr string, up bool, at time.Time) (wasUp bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.entry(addr)
+	wasUp = st.up
+	st.up, st.lastCheck = up, at
+	return wasUp
+}
+
+// synced - record a successful sync with a peer
+func (p *peerStates) synced(addr string, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entry(addr).lastSync = at
+}
+
+// get - the state of a peer; the zero state if nothing is known about it
+func (p *peerStates) get(addr string) peerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if st, ok := p.peers[addr]; ok {
+		return *st
+	}
+	return peerState{}
+}
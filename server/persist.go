@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// snapshotFile is the name of the snapshot in the data dir
+const snapshotFile = "snapshot.json"
+
+// defaultSaveInterval is used when WithDataDir is given no interval
+const defaultSaveInterval = 10 * time.Second
+
+// loadSnapshot - restore the snapshot saved in dir, if there is one
+func loadSnapshot(s *store.Store, dir string) error {
+	err := s.LoadFile(filepath.Join(dir, snapshotFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// persist - save a snapshot to the data dir every save interval until ctx
+// is done, skipping intervals in which nothing changed
+func (srv *Server) persist(ctx context.Context) {
+	interval := srv.saveInterval
+	if interval <= 0 {
+		interval = defaultSaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s := srv.store
+	saved := s.NextChangeSeq()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		next := s.NextChangeSeq()
+		if next == saved {
+			continue
+		}
+		if err := s.SaveFile(filepath.Join(srv.dataDir, snapshotFile)); err != nil {
+			srv.logger.Error("saving snapshot failed", "err", err)
+			continue
+		}
+		saved = next
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerPipelining(t *testing.T) {
+	s := store.New()
+
+	go Start(":9055", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9055")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// Many commands in a single write get their replies in order
+	var batch strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&batch, "SET pipe:%d v%d\nGET pipe:%d\n", i, i, i)
+	}
+	fmt.Fprint(conn, batch.String())
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < 100; i++ {
+		set, _ := reader.ReadString('\n')
+		get, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply %d: %v", i, err)
+		}
+		if strings.TrimSpace(set) != "OK" || strings.TrimSpace(get) != fmt.Sprintf("v%d", i) {
+			t.Fatalf("Unexpected replies for %d: %q %q", i, set, get)
+		}
+	}
+}
+
+func TestServerRequestIDs(t *testing.T) {
+	s := store.New()
+
+	go Start(":9056", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9056")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// A blocking pop with a req-id doesn't hold up later requests
+	fmt.Fprintf(conn, "DEL reqjobs\n")
+	reader.ReadString('\n')
+
+	fmt.Fprintf(conn, "BLPOP reqjobs 5|req-id:1\n")
+	fmt.Fprintf(conn, "SET reqkey v|req-id:2\n")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, _ := reader.ReadString('\n')
+	if strings.TrimSpace(response) != "OK|req-id:2" {
+		t.Errorf("Expected the SET reply first, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "RPUSH reqjobs job1|req-id:3\n")
+
+	replies := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		replies[strings.TrimSpace(response)] = true
+	}
+	if !replies["reqjobs job1|req-id:1"] || !replies["1|req-id:3"] {
+		t.Errorf("Unexpected tagged replies: %v", replies)
+	}
+
+	// Mode changes must run in order
+	fmt.Fprintf(conn, "SUBSCRIBE news|req-id:4\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "ERROR") || !strings.Contains(response, "req-id:4") {
+		t.Errorf("Expected SUBSCRIBE with a req-id to be rejected, got: %s", response)
+	}
+}
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// subscriberBufferSize is how many pushed messages may queue up for a
+	// subscriber before it is considered too slow and disconnected
+	subscriberBufferSize = 1024
+
+	// seenMessagesLimit bounds the msg-id history used to drop duplicate
+	// PUBLISH deliveries from peers
+	seenMessagesLimit = 10000
+)
+
+// broker fans PUBLISH messages out to the subscribed connections on this node
+type broker struct {
+	mu       sync.RWMutex
+	channels map[string]map[*subscriber]bool
+	patterns map[string]map[*subscriber]bool
+	seen     *recentIDs
+	logger   *slog.Logger
+}
+
+// subscriber is a connection in push mode. Everything written to it goes
+// through out so pushed messages and replies never interleave.
+type subscriber struct {
+	conn     net.Conn
+	out      chan string
+	done     chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
+	channels map[string]bool
+	patterns map[string]bool
+	logger   *slog.Logger
+}
+
+func newBroker(logger *slog.Logger) *broker {
+	return &broker{
+		channels: make(map[string]map[*subscriber]bool),
+		patterns: make(map[string]map[*subscriber]bool),
+		seen:     newRecentIDs(seenMessagesLimit),
+		logger:   logger,
+	}
+}
+
+func newSubscriber(conn net.Conn, logger *slog.Logger) *subscriber {
+	sub := &subscriber{
+		conn:     conn,
+		logger:   logger,
+		out:      make(chan string, subscriberBufferSize),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+	go sub.writeLoop()
+	return sub
+}
+
+// writeLoop - drain queued messages to the connection
+func (sub *subscriber) writeLoop() {
+	defer close(sub.finished)
+
+	for {
+		select {
+		case line := <-sub.out:
+			if _, err := fmt.Fprintln(sub.conn, line); err != nil {
+				sub.close()
+				return
+			}
+		case <-sub.done:
+			// Flush whatever was queued before leaving push mode
+			for {
+				select {
+				case line := <-sub.out:
+					fmt.Fprintln(sub.conn, line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send - queue a line for the subscriber, disconnecting it if it can't keep up
+func (sub *subscriber) send(line string) bool {
+	select {
+	case sub.out <- line:
+		return true
+	case <-sub.done:
+		return false
+	default:
+		sub.logger.Warn("disconnecting slow subscriber", "client", sub.conn.RemoteAddr().String())
+		sub.close()
+		return false
+	}
+}
+
+// stop - flush queued messages and stop the writer
+func (sub *subscriber) stop() {
+	sub.stopOnce.Do(func() { close(sub.done) })
+	<-sub.finished
+}
+
+// close - drop the connection, which also stops the writer
+func (sub *subscriber) close() {
+	sub.conn.Close()
+	sub.stopOnce.Do(func() { close(sub.done) })
+}
+
+// count - number of channels and patterns the subscriber listens on
+func (sub *subscriber) count() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+func (b *broker) subscribe(sub *subscriber, channel string, pattern bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	index, names := b.channels, sub.channels
+	if pattern {
+		index, names = b.patterns, sub.patterns
+	}
+	if index[channel] == nil {
+		index[channel] = make(map[*subscriber]bool)
+	}
+	index[channel][sub] = true
+	names[channel] = true
+}
+
+func (b *broker) unsubscribe(sub *subscriber, channel string, pattern bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	index, names := b.channels, sub.channels
+	if pattern {
+		index, names = b.patterns, sub.patterns
+	}
+	delete(index[channel], sub)
+	if len(index[channel]) == 0 {
+		delete(index, channel)
+	}
+	delete(names, channel)
+}
+
+// unsubscribeAll - drop every subscription held by sub
+func (b *broker) unsubscribeAll(sub *subscriber) {
+	for channel := range sub.channels {
+		b.unsubscribe(sub, channel, false)
+	}
+	for pattern := range sub.patterns {
+		b.unsubscribe(sub, pattern, true)
+	}
+}
+
+// publish - deliver a message to local subscribers and return how many got it
+func (b *broker) publish(channel, message string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	delivered := 0
+	for sub := range b.channels[channel] {
+		if sub.send(framePush(sub.conn, fmt.Sprintf("message %s %s", channel, message))) {
+			delivered++
+		}
+	}
+	for pattern, subs := range b.patterns {
+		if !matchPattern(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			if sub.send(framePush(sub.conn, fmt.Sprintf("pmessage %s %s %s", pattern, channel, message))) {
+				delivered++
+			}
+		}
+	}
+	return delivered
+}
+
+// handleSubscribeCommand - handle (P)SUBSCRIBE and (P)UNSUBSCRIBE
+//
+// The first subscription switches the connection into push mode and the
+// returned subscriber must be used for all further writes. Once the last
+// subscription is dropped the connection goes back to normal and nil is
+// returned.
+func handleSubscribeCommand(conn net.Conn, b *broker, sub *subscriber, cmd string, args []string) *subscriber {
+	pattern := strings.HasPrefix(cmd, "P")
+	kind := strings.ToLower(cmd)
+
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(args) == 0 {
+			writeReply(conn, sub, frameError(conn, ErrCodeSyntax, fmt.Sprintf("Usage: %s channel [channel ...]", cmd)))
+			return sub
+		}
+		if sub == nil {
+			sub = newSubscriber(conn, b.logger)
+		}
+		for _, channel := range args {
+			b.subscribe(sub, channel, pattern)
+			sub.send(frameValue(conn, fmt.Sprintf("%s %s %d", kind, channel, sub.count())))
+		}
+		return sub
+
+	default: // UNSUBSCRIBE, PUNSUBSCRIBE
+		if sub == nil {
+			writeReply(conn, sub, frameValue(conn, kind+" 0"))
+			return nil
+		}
+
+		if len(args) == 0 {
+			names := sub.channels
+			if pattern {
+				names = sub.patterns
+			}
+			for name := range names {
+				args = append(args, name)
+			}
+			sort.Strings(args)
+		}
+		for _, channel := range args {
+			b.unsubscribe(sub, channel, pattern)
+			sub.send(frameValue(conn, fmt.Sprintf("%s %s %d", kind, channel, sub.count())))
+		}
+
+		if sub.count() == 0 {
+			sub.stop()
+			return nil
+		}
+		return sub
+	}
+}
+
+// handlePublish - deliver a message locally and fan it out to peers
+//
+// Messages from peers carry the msg-id of the original PUBLISH; each id is
+// delivered at most once per node, so a subscriber sees every message once
+// no matter how many times it reaches this node.
+func (srv *Server) handlePublish(conn net.Conn, args []string, msgID string) {
+	b := srv.broker
+
+	if len(args) < 2 {
+		replyError(conn, ErrCodeSyntax, "Usage: PUBLISH channel message")
+		return
+	}
+
+	channel, message := args[0], strings.Join(args[1:], " ")
+
+	replicated := msgID != ""
+	if !replicated {
+		msgID = srv.store.NewMsgID()
+	}
+	if !b.seen.add(msgID) {
+		replyValue(conn, 0)
+		return
+	}
+
+	delivered := b.publish(channel, message)
+
+	if !replicated {
+		line := fmt.Sprintf("PUBLISH %s %s|msg-id:%s|ts:%d", channel, message, msgID, srv.now().UnixNano())
+		srv.broadcast(line)
+	}
+	replyValue(conn, delivered)
+}
+
+// writeReply - write a framed line directly or through the subscriber in
+// push mode
+func writeReply(conn net.Conn, sub *subscriber, line string) {
+	if sub != nil {
+		sub.send(line)
+		return
+	}
+	fmt.Fprintln(conn, line)
+}
+
+// recentIDs remembers the most recent ids up to a fixed limit
+type recentIDs struct {
+	mu    sync.Mutex
+	ids   map[string]bool
+	order []string
+	limit int
+}
+
+func newRecentIDs(limit int) *recentIDs {
+	return &recentIDs{ids: make(map[string]bool), limit: limit}
+}
+
+// add records id and reports whether it was new
+func (r *recentIDs) add(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ids[id] {
+		return false
+	}
+	r.ids[id] = true
+	r.order = append(r.order, id)
+	if len(r.order) > r.limit {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+	return true
+}
+
+// len - how many ids are remembered
+func (r *recentIDs) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.ids)
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"news.*", "news.sports", true},
+		{"news/*", "news/sports/football", true},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"user:\\*", "user:*", true},
+		{"user:\\*", "user:1", false},
+		{"*", "", true},
+		{"abc", "abcd", false},
+	}
+
+	for _, c := range cases {
+		if got := matchPattern(c.pattern, c.name); got != c.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestServerPubSub(t *testing.T) {
+	s := store.New()
+
+	go Start(":9037", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	subConn, err := net.Dial("tcp", "localhost:9037")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer subConn.Close()
+
+	pubConn, err := net.Dial("tcp", "localhost:9037")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer pubConn.Close()
+
+	subReader := bufio.NewReader(subConn)
+	pubReader := bufio.NewReader(pubConn)
+
+	fmt.Fprintf(subConn, "SUBSCRIBE news\n")
+	response, _ := subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "subscribe news 1" {
+		t.Errorf("Unexpected SUBSCRIBE response: %s", response)
+	}
+
+	fmt.Fprintf(subConn, "PSUBSCRIBE user:*\n")
+	response, _ = subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "psubscribe user:* 2" {
+		t.Errorf("Unexpected PSUBSCRIBE response: %s", response)
+	}
+
+	// Regular commands are rejected in push mode
+	fmt.Fprintf(subConn, "GET foo\n")
+	response, _ = subReader.ReadString('\n')
+	if !strings.HasPrefix(response, "ERROR") {
+		t.Errorf("Expected GET to be rejected while subscribed, got: %s", response)
+	}
+
+	fmt.Fprintf(pubConn, "PUBLISH news hello world\n")
+	response, _ = pubReader.ReadString('\n')
+	if strings.TrimSpace(response) != "1" {
+		t.Errorf("Expected 1 receiver, got: %s", response)
+	}
+
+	response, _ = subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "message news hello world" {
+		t.Errorf("Unexpected message: %s", response)
+	}
+
+	fmt.Fprintf(pubConn, "PUBLISH user:42 login\n")
+	pubReader.ReadString('\n')
+
+	response, _ = subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "pmessage user:* user:42 login" {
+		t.Errorf("Unexpected pattern message: %s", response)
+	}
+
+	// Leaving every subscription returns to normal mode
+	fmt.Fprintf(subConn, "UNSUBSCRIBE\n")
+	subReader.ReadString('\n')
+	fmt.Fprintf(subConn, "PUNSUBSCRIBE\n")
+	response, _ = subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "punsubscribe user:* 0" {
+		t.Errorf("Unexpected PUNSUBSCRIBE response: %s", response)
+	}
+
+	fmt.Fprintf(subConn, "GET foo\n")
+	response, _ = subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "Key not found" {
+		t.Errorf("Expected normal GET after unsubscribing, got: %s", response)
+	}
+}
+
+func TestServerPubSubAcrossNodes(t *testing.T) {
+	s1 := store.New()
+	s2 := store.New()
+
+	go New(s1, WithAddr(":9040"), WithPeers("localhost:9041"), WithPeerSecret(testSecret)).Start()
+	go New(s2, WithAddr(":9041"), WithPeers("localhost:9040"), WithPeerSecret(testSecret)).Start()
+
+	time.Sleep(200 * time.Millisecond)
+
+	subConn, err := net.Dial("tcp", "localhost:9041")
+	if err != nil {
+		t.Fatalf("Failed to connect to node 2: %v", err)
+	}
+	defer subConn.Close()
+
+	subReader := bufio.NewReader(subConn)
+	fmt.Fprintf(subConn, "SUBSCRIBE events\n")
+	subReader.ReadString('\n')
+
+	pubConn, err := net.Dial("tcp", "localhost:9040")
+	if err != nil {
+		t.Fatalf("Failed to connect to node 1: %v", err)
+	}
+	defer pubConn.Close()
+
+	fmt.Fprintf(pubConn, "PUBLISH events deployed\n")
+	bufio.NewReader(pubConn).ReadString('\n')
+
+	subConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := subReader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Expected message from the other node: %v", err)
+	}
+	if strings.TrimSpace(response) != "message events deployed" {
+		t.Errorf("Unexpected message: %s", response)
+	}
+
+	// Replaying the same msg-id on node 2 must not deliver it again
+	replay, err := (&peer.Client{Secret: testSecret}).Dial("localhost:9041", time.Second)
+	if err != nil {
+		t.Fatalf("Failed to connect to node 2: %v", err)
+	}
+	defer replay.Close()
+
+	replayID := fmt.Sprintf("replay-%d", time.Now().UnixNano())
+	fmt.Fprintf(replay, "PUBLISH events once|msg-id:%s|ts:1\n", replayID)
+	fmt.Fprintf(replay, "PUBLISH events once|msg-id:%s|ts:1\n", replayID)
+	replayReader := bufio.NewReader(replay)
+	replayReader.ReadString('\n')
+	replayReader.ReadString('\n')
+
+	response, _ = subReader.ReadString('\n')
+	if strings.TrimSpace(response) != "message events once" {
+		t.Errorf("Unexpected message: %s", response)
+	}
+
+	subConn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if response, err := subReader.ReadString('\n'); err == nil {
+		t.Errorf("Expected duplicate to be dropped, got: %s", response)
+	}
+}
+
+func TestPublishMsgIDNamesOrigin(t *testing.T) {
+	l := listen(t)
+	s := store.New()
+	srv := startTestServer(t, s, WithListener(l), WithLogger(discardLogger))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	sender(conn)("PUBLISH events deployed")
+
+	// Published messages get msg-ids like every other write
+	srv.broker.seen.mu.Lock()
+	defer srv.broker.seen.mu.Unlock()
+	if len(srv.broker.seen.order) != 1 || store.OriginOf(srv.broker.seen.order[0]) != s.NodeID() {
+		t.Errorf("Expected a msg-id from node %s, got %v", s.NodeID(), srv.broker.seen.order)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// Protocol versions. Connections start with the legacy bare-string replies;
+// HELLO 2 switches them to framed replies, where the first character of
+// every line says what it is:
+//
+//	+<value>        success, the rest of the line is the value
+//	_               null, e.g. GET of a missing key
+//	-<CODE> <msg>   error with a stable, machine readable code
+//	><line>         pushed by a stream (pub/sub, WATCHKEYS, CDC, MONITOR)
+const (
+	protoLegacy = 1
+	protoFramed = 2
+)
+
+// Error codes carried by error frames
+const (
+	ErrCodeSyntax         = "ERR_SYNTAX"          // wrong arguments
+	ErrCodeUnknownCommand = "ERR_UNKNOWN_COMMAND" // no such command
+	ErrCodeWrongType      = "ERR_WRONGTYPE"       // key holds another type
+	ErrCodeNotInteger     = "ERR_NOTINTEGER"      // value is not an integer
+	ErrCodeNotFloat       = "ERR_NOTFLOAT"        // score is not a finite float
+	ErrCodeOverflow       = "ERR_OVERFLOW"        // the result of an increment is out of range
+	ErrCodeState          = "ERR_STATE"           // not allowed in the connection's current mode
+	ErrCodeAuth           = "ERR_AUTH"            // authentication failed or required
+	ErrCodeNoPerm         = "ERR_NOPERM"          // the user may not run the command or touch the key
+	ErrCodeTruncated      = "ERR_TRUNCATED"       // CDC offset no longer retained
+	ErrCodeBadOffset      = "ERR_BADOFFSET"       // CDC offset past the end of the log or from before a restart
+	ErrCodeNotReady       = "ERR_NOTREADY"        // HEALTH READY before the startup sync is over
+	ErrCodeInternal       = "ERR_INTERNAL"        // the server failed
+)
+
+// framer is implemented by connections that know their protocol version
+type framer interface {
+	framed() bool
+}
+
+func isFramed(w io.Writer) bool {
+	f, ok := w.(framer)
+	return ok && f.framed()
+}
+
+// frameValue - a success line
+func frameValue(w io.Writer, v interface{}) string {
+	if isFramed(w) {
+		return fmt.Sprintf("+%v", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// frameNull - a null line; legacy clients get the old message instead
+func frameNull(w io.Writer, legacy string) string {
+	if isFramed(w) {
+		return "_"
+	}
+	return legacy
+}
+
+// frameError - an error line. Legacy clients get the message as it always
+// read: usage messages and unknown commands as is, wrong type errors with a
+// WRONGTYPE prefix and everything else with an ERROR: prefix.
+func frameError(w io.Writer, code, msg string) string {
+	if isFramed(w) {
+		return fmt.Sprintf("-%s %s", code, msg)
+	}
+
+	switch {
+	case code == ErrCodeUnknownCommand, strings.HasPrefix(msg, "Usage:"):
+		return msg
+	case code == ErrCodeWrongType:
+		return "WRONGTYPE " + msg
+	}
+	return "ERROR: " + msg
+}
+
+// framePush - a line pushed by a stream
+func framePush(w io.Writer, line string) string {
+	if isFramed(w) {
+		return ">" + line
+	}
+	return line
+}
+
+func replyValue(w io.Writer, v interface{}) {
+	fmt.Fprintln(w, frameValue(w, v))
+}
+
+func replyNull(w io.Writer, legacy string) {
+	fmt.Fprintln(w, frameNull(w, legacy))
+}
+
+func replyError(w io.Writer, code, msg string) {
+	fmt.Fprintln(w, frameError(w, code, msg))
+}
+
+// replyStoreError - report an error returned by the store
+func replyStoreError(w io.Writer, err error) {
+	replyError(w, storeErrorCode(err), storeErrorMessage(err))
+}
+
+func storeErrorCode(err error) string {
+	var truncated *store.OffsetTruncatedError
+	var ahead *store.OffsetAheadError
+	switch {
+	case errors.Is(err, store.ErrWrongType):
+		return ErrCodeWrongType
+	case errors.Is(err, store.ErrNotInteger):
+		return ErrCodeNotInteger
+	case errors.Is(err, store.ErrNotFloat):
+		return ErrCodeNotFloat
+	case errors.Is(err, store.ErrOverflow):
+		return ErrCodeOverflow
+	case errors.As(err, &truncated):
+		return ErrCodeTruncated
+	case errors.As(err, &ahead):
+		return ErrCodeBadOffset
+	}
+	return ErrCodeInternal
+}
+
+func storeErrorMessage(err error) string {
+	if errors.Is(err, store.ErrWrongType) {
+		return "Operation against a key holding the wrong kind of value"
+	}
+	return err.Error()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerFramedReplies(t *testing.T) {
+	s := store.New()
+
+	go Start(":9058", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9058")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	fmt.Fprintf(conn, "HELLO 2\n")
+	response, _ := reader.ReadString('\n')
+	if strings.TrimSpace(response) != "+HELLO 2" {
+		t.Fatalf("Unexpected HELLO response: %s", response)
+	}
+
+	cases := []struct {
+		cmd, want string
+	}{
+		{"DEL framed:missing", "+DELETED"},
+		{"GET framed:missing", "_"},
+		// A stored value that reads like the legacy null reply is still a value
+		{"SET framed:v Key", "+OK"},
+		{"GET framed:v", "+Key"},
+		{"GET", "-ERR_SYNTAX Usage: GET key"},
+		{"NOPE", "-ERR_UNKNOWN_COMMAND Unknown command: NOPE"},
+		{"HGETALL framed:v", "-ERR_WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"HELLO 3", "-ERR_SYNTAX Usage: HELLO [1|2]"},
+		{"SET framed:w a", "+OK"},
+		{"SET framed:w b", "+OK"},
+		{"CDC 1", "-ERR_TRUNCATED"},
+	}
+	s.SetChangeLogRetention(1)
+
+	for _, c := range cases {
+		fmt.Fprintf(conn, "%s\n", c.cmd)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply to %s: %v", c.cmd, err)
+		}
+		if !strings.HasPrefix(strings.TrimSpace(response), c.want) {
+			t.Errorf("%s: expected %q, got %q", c.cmd, c.want, strings.TrimSpace(response))
+		}
+	}
+
+	// The snapshot comes back as a single frame
+	fmt.Fprintf(conn, "SYNC\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "+{") {
+		t.Errorf("Expected the snapshot in one frame, got: %s", response)
+	}
+
+	// HELLO 1 goes back to the legacy replies
+	fmt.Fprintf(conn, "HELLO 1\n")
+	reader.ReadString('\n')
+	fmt.Fprintf(conn, "GET framed:missing\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "Key not found" {
+		t.Errorf("Expected the legacy reply, got: %s", response)
+	}
+}
@@ -2,297 +2,595 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Ahmedhossamdev/simple-kv/acl"
 	"github.com/Ahmedhossamdev/simple-kv/peer"
 	"github.com/Ahmedhossamdev/simple-kv/store"
-	"github.com/google/uuid"
 )
 
+// Start serves the line protocol on addr with the default settings. It
+// only returns if the listener fails; use New to configure the node or to
+// be able to shut it down. Peers authenticate with the secret in
+// $SIMPLE_KV_PEER_SECRET, so with peers and no secret it returns an error.
 func Start(addr string, s *store.Store, peers []string) error {
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
+	return New(s, WithAddr(addr), WithPeers(peers...), WithPeerSecret(os.Getenv("SIMPLE_KV_PEER_SECRET"))).Start()
+}
+
+func (srv *Server) handleConnection(cl *client) {
+	conn := cl.conn
+	defer conn.Close()
+
+	srv.metrics.connections.Inc()
+	defer srv.metrics.connections.Dec()
+
+	se := &session{
+		srv:      srv,
+		client:   cl,
+		conn:     newBufferedConn(conn, countingWriter{conn, srv.metrics.bytesOut, &cl.bytesOut}),
+		inFlight: make(chan struct{}, srv.settings.MaxInFlight),
+		gone:     make(chan struct{}),
 	}
+	defer se.close()
 
-	// Start automatic sync services if we have peers
-	if len(peers) > 0 {
-		// Startup sync - sync when node starts
-		go func() {
-			time.Sleep(3 * time.Second) // Wait for server to be ready
-			fmt.Println("🔄 Starting automatic startup sync...")
-			performStartupSync(s, peers)
-		}()
+	reader := bufio.NewReaderSize(countingReader{conn, srv.metrics.bytesIn, &cl.bytesIn}, 64*1024)
+	lines := make(chan inputLine)
+	go se.readLines(reader, lines)
 
-		// Periodic sync - sync every 30 seconds
-		go func() {
-			time.Sleep(10 * time.Second) // Wait longer for initial startup
-			fmt.Println("🔄 Starting periodic sync service...")
-			startPeriodicSync(s, peers)
-		}()
+	for in := range lines {
+		mainParts := strings.Split(in.text, "|")
+		cmdParts := strings.Fields(mainParts[0])
 
-		// Peer recovery monitor - detect when peers come back online
-		go func() {
-			time.Sleep(5 * time.Second)
-			fmt.Println("🔍 Starting peer recovery monitor...")
-			startPeerRecoveryMonitor(s, peers)
-		}()
+		if len(cmdParts) > 0 {
+			se.handleLine(cmdParts, mainParts[1:])
+		}
+
+		// Replies to pipelined commands go out in one write once the
+		// client has nothing more queued
+		if !in.more {
+			se.conn.Flush()
+		}
 	}
+}
+
+// inputLine is one command line read from a connection
+type inputLine struct {
+	text string
+	more bool // more input was already buffered behind it
+}
 
+// readLines - feed the lines of the connection to the command loop. Reading
+// goes on while a command runs, so se.gone is closed as soon as the other
+// end hangs up and commands blocked on its behalf can give up.
+func (se *session) readLines(reader *bufio.Reader, lines chan<- inputLine) {
+	defer close(lines)
 	for {
-		conn, err := l.Accept()
+		line, err := reader.ReadString('\n')
 		if err != nil {
-			continue
+			// A read deadline means the server is shutting down, which
+			// blocked commands learn from srv.ctx; the rest of the line may
+			// still be on its way, so don't run what we have
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return
+			}
+			close(se.gone)
+			if line == "" {
+				return
+			}
+		}
+		lines <- inputLine{text: strings.TrimRight(line, "\r\n"), more: reader.Buffered() > 0}
+		if err != nil {
+			return
 		}
-		go handleConnection(conn, s, peers)
 	}
 }
 
-func handleConnection(conn net.Conn, s *store.Store, peers []string) {
-	defer conn.Close()
+// session is the state of one client connection
+type session struct {
+	srv    *Server
+	client *client // entry in the connection registry (CLIENT LIST)
+	conn   *bufferedConn
+	// Closed once the connection has hung up or been killed
+	gone chan struct{}
+
+	// Set once the connection subscribes to a channel (push mode)
+	sub *subscriber
+	// Set while the connection streams keyspace events (WATCHKEYS)
+	watcher *keyWatcher
+	// Set while the connection streams the change log (CDC)
+	cdc *cdcStream
+	// Set while the connection streams every command (MONITOR)
+	monitor *monitor
+
+	// Set once the other end has authenticated as a peer (PEER AUTH)
+	peer  bool
+	nonce string
+	// Set once the client has logged in with AUTH
+	user *acl.User
+
+	// Requests with a req-id run concurrently, at most Settings.MaxInFlight at a time
+	inFlight chan struct{}
+	pending  sync.WaitGroup
+}
 
-	scanner := bufio.NewScanner(conn)
+// peerAuthOn - whether peers can authenticate at all: an empty secret is
+// no secret, so it takes one, or mutual TLS to vouch for the peer instead
+func (srv *Server) peerAuthOn() bool {
+	return srv.peerSecret != "" || (srv.tls != nil && srv.tls.Mutual())
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+// peerCertified - with mutual TLS, peers must have presented a certificate
+// signed by the CA
+func (se *session) peerCertified() bool {
+	tc, ok := se.conn.Conn.(*tls.Conn)
+	if !ok {
+		return true
+	}
+	if r := se.srv.tls; r == nil || !r.Mutual() {
+		return true
+	}
+	return len(tc.ConnectionState().VerifiedChains) > 0
+}
 
-		fmt.Println(line)
+// close - wait for requests still running, end any stream and flush
+func (se *session) close() {
+	se.pending.Wait()
 
-		mainParts := strings.Split(line, "|")
-		cmdParts := strings.Fields(mainParts[0])
+	if se.sub != nil {
+		se.srv.broker.unsubscribeAll(se.sub)
+		se.sub.close()
+	}
+	if se.watcher != nil {
+		se.watcher.stop()
+	}
+	if se.cdc != nil {
+		se.cdc.stop()
+	}
+	if se.monitor != nil {
+		se.srv.monitors.stop(se.monitor)
+	}
+	se.conn.Flush()
+}
 
-		if len(cmdParts) == 0 {
-			continue
+// handleLine - parse the metadata of one command line and run it
+func (se *session) handleLine(cmdParts, meta []string) {
+	cmd := strings.ToUpper(cmdParts[0])
+	se.client.touch(cmd)
+
+	// Extract msg-id, timestamp and req-id
+	// SET X 1|msg-id:f7854c7b-9c75-486b-bf65-230717420250|ts:1754412219586286400
+	msgID := ""
+	reqID := ""
+	timestamp := se.srv.now().UnixNano()
+	for _, part := range meta {
+		if strings.HasPrefix(part, "msg-id:") {
+			msgID = strings.TrimPrefix(part, "msg-id:")
+		} else if strings.HasPrefix(part, "ts:") {
+			fmt.Sscanf(strings.TrimPrefix(part, "ts:"), "%d", &timestamp)
+		} else if strings.HasPrefix(part, "req-id:") {
+			reqID = strings.TrimPrefix(part, "req-id:")
 		}
+	}
+
+	// Replication metadata is only trusted from authenticated peers; a
+	// client could otherwise pick a timestamp that wins every future write
+	if !se.peer {
+		msgID = ""
+		timestamp = se.srv.now().UnixNano()
+	}
+
+	// Only subscription commands are allowed while in push mode
+	if se.sub != nil && cmd != "SUBSCRIBE" && cmd != "PSUBSCRIBE" && cmd != "UNSUBSCRIBE" && cmd != "PUNSUBSCRIBE" {
+		se.sub.send(frameError(se.conn, ErrCodeState, cmd+" is not allowed while subscribed"))
+		return
+	}
+	if se.watcher != nil && cmd != "UNWATCHKEYS" {
+		se.watcher.reply(frameError(se.conn, ErrCodeState, cmd+" is not allowed while watching keys"))
+		return
+	}
+	if se.cdc != nil && !isCDCStop(cmd, cmdParts[1:]) {
+		se.cdc.reply(frameError(se.conn, ErrCodeState, cmd+" is not allowed while streaming changes"))
+		return
+	}
+	if se.monitor != nil && cmd != "UNMONITOR" {
+		se.monitor.send(frameError(se.conn, ErrCodeState, cmd+" is not allowed while monitoring"))
+		return
+	}
 
-		cmd := strings.ToUpper(cmdParts[0])
-
-		// Extract msg-id and timestamp
-		// SET X 1|msg-id:f7854c7b-9c75-486b-bf65-230717420250|ts:1754412219586286400
-		msgID := ""
-		timestamp := time.Now().UnixNano()
-		for _, part := range mainParts[1:] {
-			if strings.HasPrefix(part, "msg-id:") {
-				msgID = strings.TrimPrefix(part, "msg-id:")
-			} else if strings.HasPrefix(part, "ts:") {
-				fmt.Sscanf(strings.TrimPrefix(part, "ts:"), "%d", &timestamp)
+	// Clients may only run what their user allows; peers are trusted
+	if !se.peer {
+		if err := authorize(se.srv.acl, se.user, cmd, cmdParts[1:]); err != nil {
+			line := frameError(se.conn, authErrorCode(err), err.Error())
+			switch {
+			case se.sub != nil:
+				se.sub.send(line)
+			case reqID != "":
+				fmt.Fprintf(se.conn, "%s|req-id:%s\n", line, reqID)
+			default:
+				fmt.Fprintln(se.conn, line)
 			}
+			return
 		}
+	}
 
-		switch cmd {
-		case "SET":
-			if len(cmdParts) != 3 {
-				fmt.Fprintln(conn, "Usage: SET key value")
-				continue
-			}
+	if reqID == "" {
+		se.execute(se.conn, cmd, cmdParts, msgID, timestamp)
+		return
+	}
 
-			key, value := cmdParts[1], cmdParts[2]
+	// Commands that change the mode of the connection must run in order
+	if changesMode(cmd) {
+		fmt.Fprintf(se.conn, "%s|req-id:%s\n", frameError(se.conn, ErrCodeSyntax, cmd+" can't be sent with a req-id"), reqID)
+		return
+	}
 
-			if msgID == "" {
-				msgID = uuid.New().String()
-				timestamp = time.Now().UnixNano()
-				// Rebuild full message including metadata
-				line = fmt.Sprintf("SET %s %s|msg-id:%s|ts:%d", key, value, msgID, timestamp)
-				// Broadcast to peers
-				peer.BroadcastToPeers(peers, line)
-			}
+	se.inFlight <- struct{}{}
+	se.pending.Add(1)
+	go func() {
+		defer func() {
+			<-se.inFlight
+			se.pending.Done()
+		}()
 
-			s.Set(key, value, timestamp, msgID)
-			fmt.Fprintln(conn, "OK")
+		reply := &taggedConn{Conn: se.conn}
+		se.execute(reply, cmd, cmdParts, msgID, timestamp)
+		se.conn.writeNow(reply.tagged(reqID))
+	}()
+}
 
-		case "DEL", "DELETE":
-			if len(cmdParts) != 2 {
-				fmt.Fprintln(conn, "Usage: DEL key")
-				continue
-			}
+// dispatch - run one command, writing its reply to conn
+func (se *session) dispatch(conn net.Conn, cmd string, cmdParts []string, msgID string, timestamp int64) {
+	srv, s := se.srv, se.srv.store
 
-			key := cmdParts[1]
+	switch cmd {
+	case "SET":
+		if len(cmdParts) != 3 {
+			replyError(conn, ErrCodeSyntax, "Usage: SET key value")
+			return
+		}
 
-			if msgID == "" {
-				msgID = uuid.New().String()
-				timestamp = time.Now().UnixNano()
-				line = fmt.Sprintf("DEL %s|msg-id:%s|ts:%d", key, msgID, timestamp)
-				peer.BroadcastToPeers(peers, line)
-			}
+		key, value := cmdParts[1], cmdParts[2]
 
+		if msgID == "" {
+			srv.clientSet(key, value)
+		} else {
+			s.Set(key, value, timestamp, msgID)
+		}
+		replyValue(conn, "OK")
+
+	case "DEL", "DELETE":
+		if len(cmdParts) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: DEL key")
+			return
+		}
+
+		key := cmdParts[1]
+
+		if msgID == "" {
+			srv.clientDel(key)
+		} else {
 			s.Del(key, timestamp, msgID)
-			fmt.Fprintln(conn, "DELETED")
-		case "GET":
-			if len(cmdParts) != 2 {
-				fmt.Fprintln(conn, "Usage: GET key")
-				continue
-			}
-			key := cmdParts[1]
-			value, ok := s.Get(key)
-			if ok {
-				fmt.Fprintln(conn, value)
-			} else {
-				fmt.Fprintln(conn, "Key not found")
+		}
+		replyValue(conn, "DELETED")
+	case "GET":
+		if len(cmdParts) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: GET key")
+			return
+		}
+		key := cmdParts[1]
+		value, ok := s.Get(key)
+		if ok {
+			replyValue(conn, value)
+		} else if s.Type(key) != store.TypeNone {
+			replyStoreError(conn, store.ErrWrongType)
+		} else {
+			replyNull(conn, "Key not found")
+		}
+	case "TYPE":
+		if len(cmdParts) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: TYPE key")
+			return
+		}
+		replyValue(conn, s.Type(cmdParts[1]))
+	case "HSET", "HGET", "HGETALL", "HDEL", "HINCRBY":
+		srv.handleHashCommand(conn, cmd, cmdParts[1:], msgID, timestamp)
+	case "LPUSH", "RPUSH", "LPOP", "RPOP", "BLPOP", "BRPOP", "LRANGE", "LLEN", "LREMID":
+		srv.handleListCommand(conn, se.gone, cmd, cmdParts[1:], msgID, timestamp)
+	case "ZADD", "ZREM", "ZSCORE", "ZRANK", "ZRANGE", "ZRANGEBYSCORE", "ZINCRBY":
+		srv.handleZSetCommand(conn, cmd, cmdParts[1:], msgID, timestamp)
+	case "SYNC":
+		// Handle data synchronization requests
+		if len(cmdParts) == 1 {
+			// Return our snapshot
+			snapshot, err := s.GetSnapshot()
+			if err != nil {
+				replyError(conn, ErrCodeInternal, "Failed to get snapshot")
+				return
 			}
-		case "SYNC":
-			// Handle data synchronization requests
-			if len(cmdParts) == 1 {
-				// Return our snapshot
-				snapshot, err := s.GetSnapshot()
-				if err != nil {
-					fmt.Fprintln(conn, "ERROR: Failed to get snapshot")
-					continue
-				}
+			// Framed replies carry the snapshot in a single frame
+			if !isFramed(conn) {
 				fmt.Fprintln(conn, "SNAPSHOT:")
-				fmt.Fprintln(conn, string(snapshot))
-			} else if len(cmdParts) == 2 && cmdParts[1] == "REQUEST" {
-				// Request sync from peers
-				for _, peer := range peers {
-					go func(peer string) {
-						peerConn, err := net.Dial("tcp", peer)
-						if err != nil {
-							fmt.Printf("Failed to connect to peer %s for sync: %v\n", peer, err)
-							return
-						}
-						defer peerConn.Close()
-
-						fmt.Fprintln(peerConn, "SYNC")
-
-						// Read the response
-						scanner := bufio.NewScanner(peerConn)
-						if scanner.Scan() && scanner.Text() == "SNAPSHOT:" {
-							if scanner.Scan() {
-								snapshotData := scanner.Text()
-								if err := s.ApplySnapshot([]byte(snapshotData)); err != nil {
-									fmt.Printf("Failed to apply snapshot from %s: %v\n", peer, err)
-								} else {
-									fmt.Printf("Successfully synced data from %s\n", peer)
-								}
-							}
-						}
-					}(peer)
-				}
-				fmt.Fprintln(conn, "SYNC requested from all peers")
 			}
-		case "STATS":
-			// Return store statistics
-			stats := s.GetStats()
-			statsJSON, _ := json.Marshal(stats)
-			fmt.Fprintln(conn, string(statsJSON))
+			replyValue(conn, string(snapshot))
+		} else if len(cmdParts) == 2 && cmdParts[1] == "REQUEST" {
+			// Request sync from peers
+			srv.performSyncWithPeers()
+			replyValue(conn, "SYNC requested from all peers")
+		}
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		se.sub = handleSubscribeCommand(se.conn.pusher(), srv.broker, se.sub, cmd, cmdParts[1:])
+	case "PUBLISH":
+		srv.handlePublish(conn, cmdParts[1:], msgID)
+	case "WATCHKEYS":
+		if len(cmdParts) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: WATCHKEYS pattern")
+			return
+		}
+		se.watcher = startKeyWatcher(se.conn.pusher(), s, cmdParts[1])
+	case "UNWATCHKEYS":
+		if se.watcher != nil {
+			se.watcher.stop()
+			se.watcher = nil
+		}
+		replyValue(conn, "unwatched")
+	case "MONITOR":
+		if len(cmdParts) != 1 {
+			replyError(conn, ErrCodeSyntax, "Usage: MONITOR")
+			return
+		}
+		se.monitor = srv.monitors.start(se.conn.pusher(), srv.logger)
+	case "UNMONITOR":
+		if se.monitor != nil {
+			srv.monitors.stop(se.monitor)
+			se.monitor = nil
+		}
+		replyValue(conn, "OK")
+	case "CLIENT":
+		se.handleClient(conn, cmdParts[1:])
+	case "CDC":
+		if se.cdc != nil {
+			replyValue(conn, "stopped "+formatCDCOffset(s, se.cdc.stop()))
+			se.cdc = nil
+			return
+		}
+		se.cdc = startCDC(se.conn.pusher(), s, cmdParts[1:])
+	case "PEER":
+		// Peer handshake, see peer.Dial
+		switch {
+		case len(cmdParts) == 2 && strings.ToUpper(cmdParts[1]) == "HELLO":
+			se.nonce = peer.NewChallenge()
+			replyValue(conn, "CHALLENGE "+se.nonce)
+		case len(cmdParts) == 3 && strings.ToUpper(cmdParts[1]) == "AUTH":
+			if se.nonce == "" || !srv.peerAuthOn() || !srv.client.Verify(se.nonce, cmdParts[2]) || !se.peerCertified() {
+				se.nonce = ""
+				replyError(conn, ErrCodeAuth, "peer authentication failed")
+				return
+			}
+			se.nonce = ""
+			se.peer = true
+			se.client.loggedIn("")
+			replyValue(conn, "OK")
 		default:
-			fmt.Fprintln(conn, "Unknown command:", cmd)
+			replyError(conn, ErrCodeSyntax, "Usage: PEER HELLO | PEER AUTH response")
 		}
+	case "AUTH":
+		// AUTH password logs in as the default user
+		r := srv.acl
+		if r == nil {
+			replyError(conn, ErrCodeState, "AUTH used but no users are configured")
+			return
+		}
+		var name, password string
+		switch len(cmdParts) {
+		case 2:
+			name, password = acl.DefaultUser, cmdParts[1]
+		case 3:
+			name, password = cmdParts[1], cmdParts[2]
+		default:
+			replyError(conn, ErrCodeSyntax, "Usage: AUTH [username] password")
+			return
+		}
+		u, err := r.Authenticate(name, password)
+		if err != nil {
+			replyError(conn, ErrCodeAuth, err.Error())
+			return
+		}
+		se.user = u
+		se.client.loggedIn(u.Name)
+		replyValue(conn, "OK")
+	case "ACL":
+		srv.handleACLCommand(conn, se.user, cmdParts[1:])
+	case "HELLO":
+		// Pick the reply format for this connection, or report it
+		version := int(se.conn.proto.Load())
+		if len(cmdParts) == 2 {
+			version, _ = strconv.Atoi(cmdParts[1])
+		}
+		if len(cmdParts) > 2 || (version != protoLegacy && version != protoFramed) {
+			replyError(conn, ErrCodeSyntax, "Usage: HELLO [1|2]")
+			return
+		}
+		se.conn.proto.Store(int32(version))
+		replyValue(conn, fmt.Sprintf("HELLO %d", version))
+	case "PING":
+		handlePing(conn, cmdParts[1:])
+	case "HEALTH":
+		srv.handleHealth(conn, cmdParts[1:])
+	case "SLOWLOG":
+		srv.handleSlowLog(conn, cmdParts[1:])
+	case "INFO":
+		srv.handleInfo(conn, cmdParts[1:])
+	case "STATS":
+		// Return store statistics
+		stats := s.GetStats()
+		statsJSON, _ := json.Marshal(stats)
+		replyValue(conn, string(statsJSON))
+	default:
+		replyError(conn, ErrCodeUnknownCommand, "Unknown command: "+cmd)
 	}
 }
 
-// Automatic sync functions
+// clientSet - apply a SET from a client and broadcast it to peers
+func (srv *Server) clientSet(key, value string) {
+	s := srv.store
+	msgID := s.NewMsgID()
+	timestamp := srv.now().UnixNano()
+	// Rebuild full message including metadata
+	line := fmt.Sprintf("SET %s %s|msg-id:%s|ts:%d", key, value, msgID, timestamp)
+	srv.broadcast(line)
 
-// performStartupSync - sync with all peers when node starts
-func performStartupSync(s *store.Store, peers []string) {
-	fmt.Println("📡 Performing startup sync with peers...")
+	s.Set(key, value, timestamp, msgID)
+}
 
-	for _, peer := range peers {
-		go func(peerAddr string) {
-			conn, err := net.DialTimeout("tcp", peerAddr, 5*time.Second)
-			if err != nil {
-				fmt.Printf("⚠️ Startup sync failed with peer %s: %v\n", peerAddr, err)
+// clientDel - apply a DEL from a client and broadcast it to peers
+func (srv *Server) clientDel(key string) {
+	s := srv.store
+	msgID := s.NewMsgID()
+	timestamp := srv.now().UnixNano()
+	line := fmt.Sprintf("DEL %s|msg-id:%s|ts:%d", key, msgID, timestamp)
+	srv.broadcast(line)
+
+	s.Del(key, timestamp, msgID)
+}
+
+// defaultNodeID - identify this node by host name and listening port
+func defaultNodeID(addr string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return host + ":" + port
+	}
+	return host
+}
+
+// Automatic sync functions
+
+// performStartupSync - sync with all peers when node starts and wait for
+// every sync to succeed or fail
+func (srv *Server) performStartupSync(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, addr := range srv.peerList() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.syncWithPeer(ctx, addr); err != nil {
+				srv.logger.Warn("startup sync failed", "peer", addr, "err", err)
 				return
 			}
-			defer conn.Close()
-
-			// Request snapshot
-			fmt.Fprintln(conn, "SYNC")
-
-			scanner := bufio.NewScanner(conn)
-			if scanner.Scan() && scanner.Text() == "SNAPSHOT:" {
-				if scanner.Scan() {
-					snapshotData := scanner.Text()
-					if err := s.ApplySnapshot([]byte(snapshotData)); err != nil {
-						fmt.Printf("❌ Failed to apply startup snapshot from %s: %v\n", peerAddr, err)
-					} else {
-						fmt.Printf("✅ Successfully synced startup data from %s\n", peerAddr)
-					}
-				}
-			}
-		}(peer)
+			srv.logger.Info("startup sync done", "peer", addr)
+		}()
 	}
+	wg.Wait()
 }
 
-// startPeriodicSync - sync with peers every 30 seconds
-func startPeriodicSync(s *store.Store, peers []string) {
-	ticker := time.NewTicker(30 * time.Second)
+// startPeriodicSync - sync with peers every SyncInterval until ctx is done
+func (srv *Server) startPeriodicSync(ctx context.Context) {
+	ticker := time.NewTicker(srv.settings.SyncInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		fmt.Println("🔄 Running periodic sync check...")
-		performSyncWithPeers(s, peers)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		srv.performSyncWithPeers()
 	}
 }
 
 // startPeerRecoveryMonitor - monitor peers and sync when they recover
-func startPeerRecoveryMonitor(s *store.Store, peers []string) {
-	// Keep track of peer status
-	peerStatus := make(map[string]bool)
-
-	// Initialize all peers as unknown
-	for _, peer := range peers {
-		peerStatus[peer] = false
-	}
-
-	ticker := time.NewTicker(10 * time.Second)
+func (srv *Server) startPeerRecoveryMonitor(ctx context.Context) {
+	ticker := time.NewTicker(srv.settings.HealthCheckInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		for _, peer := range peers {
-			wasDown := !peerStatus[peer]
-			isUp := checkPeerHealth(peer)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, addr := range srv.peerList() {
+			isUp := srv.checkPeerHealth(ctx, addr)
+			wasDown := !srv.peerStates.checked(addr, isUp, time.Now())
 
 			// If peer was down and is now up, trigger sync
 			if wasDown && isUp {
-				fmt.Printf("🔄 Peer %s recovered! Triggering sync...\n", peer)
-				go performSyncWithPeer(s, peer)
+				srv.logger.Info("peer recovered, syncing", "peer", addr)
+				srv.performSyncWithPeer(addr)
 			}
-
-			peerStatus[peer] = isUp
 		}
 	}
 }
 
-// checkPeerHealth - check if a peer is healthy
-func checkPeerHealth(peerAddr string) bool {
-	conn, err := net.DialTimeout("tcp", peerAddr, 2*time.Second)
-	if err != nil {
-		return false
+// performSyncWithPeers - sync with all peers
+func (srv *Server) performSyncWithPeers() {
+	for _, addr := range srv.peerList() {
+		srv.performSyncWithPeer(addr)
 	}
-	conn.Close()
-	return true
 }
 
-// performSyncWithPeers - sync with all peers
-func performSyncWithPeers(s *store.Store, peers []string) {
-	for _, peer := range peers {
-		go performSyncWithPeer(s, peer)
-	}
+// performSyncWithPeer - sync with a specific peer in the background
+func (srv *Server) performSyncWithPeer(peerAddr string) {
+	srv.goBackground(func() {
+		if err := srv.syncWithPeer(srv.ctx, peerAddr); err != nil {
+			srv.logger.Debug("sync failed", "peer", peerAddr, "err", err)
+		}
+	})
 }
 
-// performSyncWithPeer - sync with a specific peer
-func performSyncWithPeer(s *store.Store, peerAddr string) {
-	conn, err := net.DialTimeout("tcp", peerAddr, 3*time.Second)
+// maxSnapshotSize is the largest snapshot syncWithPeer accepts. Snapshots
+// come as one line, far longer than bufio.Scanner's default limit once
+// hashes, lists and sorted sets carry their tombstones.
+const maxSnapshotSize = 1 << 30
+
+// syncWithPeer - fetch a peer's snapshot and merge it into the store. The
+// transfer is abandoned when ctx is done.
+func (srv *Server) syncWithPeer(ctx context.Context, peerAddr string) (err error) {
+	start := time.Now()
+	size := 0
+	defer func() {
+		took := time.Since(start)
+		srv.metrics.observeSync(peerAddr, took, size, err)
+		srv.recordSlow("sync", peerAddr, "SYNC", nil, start, took)
+	}()
+
+	dialCtx, cancel := context.WithTimeout(ctx, srv.settings.SyncTimeout)
+	defer cancel()
+	conn, err := srv.client.DialContext(dialCtx, peerAddr)
 	if err != nil {
-		return // Peer is down, skip silently
+		return err
 	}
 	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	fmt.Fprintln(conn, "SYNC")
 
 	scanner := bufio.NewScanner(conn)
-	if scanner.Scan() && scanner.Text() == "SNAPSHOT:" {
-		if scanner.Scan() {
-			snapshotData := scanner.Text()
-			if err := s.ApplySnapshot([]byte(snapshotData)); err != nil {
-				fmt.Printf("❌ Periodic sync failed with %s: %v\n", peerAddr, err)
-			} else {
-				fmt.Printf("✅ Periodic sync successful with %s\n", peerAddr)
-			}
+	scanner.Buffer(make([]byte, 64*1024), maxSnapshotSize)
+	if !scanner.Scan() || scanner.Text() != "SNAPSHOT:" || !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
 		}
+		return fmt.Errorf("peer %s sent no snapshot", peerAddr)
+	}
+	size = len(scanner.Bytes())
+	if err := srv.store.ApplySnapshot(scanner.Bytes()); err != nil {
+		srv.logger.Error("applying snapshot failed", "peer", peerAddr, "err", err)
+		return err
 	}
+	srv.peerStates.synced(peerAddr, time.Now())
+	srv.logger.Debug("synced with peer", "peer", peerAddr, "bytes", size, "duration", time.Since(start))
+	return nil
 }
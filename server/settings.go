@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings are the tunables of the server; see package config for what
+// each of them does. Zero fields keep their defaults.
+type Settings struct {
+	SyncStartupDelay    time.Duration
+	SyncInterval        time.Duration
+	HealthCheckInterval time.Duration
+	SyncTimeout         time.Duration
+	HealthCheckTimeout  time.Duration
+	PeerDialTimeout     time.Duration
+	ShutdownTimeout     time.Duration
+	ReadyTimeout        time.Duration
+	SlowLogThreshold    time.Duration // negative turns the slow log off
+	SlowLogMaxLen       int
+	MaxInFlight         int
+	MaxHTTPBody         int64
+}
+
+var defaultSettings = Settings{
+	SyncStartupDelay:    3 * time.Second,
+	SyncInterval:        30 * time.Second,
+	HealthCheckInterval: 10 * time.Second,
+	SyncTimeout:         5 * time.Second,
+	HealthCheckTimeout:  2 * time.Second,
+	PeerDialTimeout:     3 * time.Second,
+	ShutdownTimeout:     8 * time.Second,
+	ReadyTimeout:        30 * time.Second,
+	SlowLogThreshold:    10 * time.Millisecond,
+	SlowLogMaxLen:       128,
+	MaxInFlight:         256,
+	MaxHTTPBody:         1 << 20,
+}
+
+// withDefaults - st with its zero fields set to the defaults
+func (st Settings) withDefaults() Settings {
+	if st.SyncStartupDelay == 0 {
+		st.SyncStartupDelay = defaultSettings.SyncStartupDelay
+	}
+	if st.SyncInterval == 0 {
+		st.SyncInterval = defaultSettings.SyncInterval
+	}
+	if st.HealthCheckInterval == 0 {
+		st.HealthCheckInterval = defaultSettings.HealthCheckInterval
+	}
+	if st.SyncTimeout == 0 {
+		st.SyncTimeout = defaultSettings.SyncTimeout
+	}
+	if st.HealthCheckTimeout == 0 {
+		st.HealthCheckTimeout = defaultSettings.HealthCheckTimeout
+	}
+	if st.PeerDialTimeout == 0 {
+		st.PeerDialTimeout = defaultSettings.PeerDialTimeout
+	}
+	if st.ShutdownTimeout == 0 {
+		st.ShutdownTimeout = defaultSettings.ShutdownTimeout
+	}
+	if st.ReadyTimeout == 0 {
+		st.ReadyTimeout = defaultSettings.ReadyTimeout
+	}
+	if st.SlowLogThreshold == 0 {
+		st.SlowLogThreshold = defaultSettings.SlowLogThreshold
+	}
+	if st.SlowLogMaxLen == 0 {
+		st.SlowLogMaxLen = defaultSettings.SlowLogMaxLen
+	}
+	if st.MaxInFlight == 0 {
+		st.MaxInFlight = defaultSettings.MaxInFlight
+	}
+	if st.MaxHTTPBody == 0 {
+		st.MaxHTTPBody = defaultSettings.MaxHTTPBody
+	}
+	return st
+}
+
+// validate - the settings withDefaults can't fix: negative values, which
+// would otherwise panic or stall the node
+func (st Settings) validate() error {
+	for name, d := range map[string]time.Duration{
+		"SyncInterval":        st.SyncInterval,
+		"HealthCheckInterval": st.HealthCheckInterval,
+		"SyncTimeout":         st.SyncTimeout,
+		"HealthCheckTimeout":  st.HealthCheckTimeout,
+		"PeerDialTimeout":     st.PeerDialTimeout,
+		"ShutdownTimeout":     st.ShutdownTimeout,
+		"ReadyTimeout":        st.ReadyTimeout,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("server: Settings.%s must be positive, got %s", name, d)
+		}
+	}
+	if st.SyncStartupDelay < 0 {
+		return fmt.Errorf("server: Settings.SyncStartupDelay must not be negative, got %s", st.SyncStartupDelay)
+	}
+	if st.SlowLogMaxLen <= 0 {
+		return fmt.Errorf("server: Settings.SlowLogMaxLen must be positive, got %d", st.SlowLogMaxLen)
+	}
+	if st.MaxInFlight <= 0 {
+		return fmt.Errorf("server: Settings.MaxInFlight must be positive, got %d", st.MaxInFlight)
+	}
+	if st.MaxHTTPBody <= 0 {
+		return fmt.Errorf("server: Settings.MaxHTTPBody must be positive, got %d", st.MaxHTTPBody)
+	}
+	return nil
+}
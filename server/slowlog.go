@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on what a slow log entry keeps of a command
+const (
+	slowLogMaxArgs   = 32
+	slowLogMaxArgLen = 128
+)
+
+// slowEntry is one command that took longer than the threshold
+type slowEntry struct {
+	ID       int64    `json:"id"`
+	Time     string   `json:"time"` // RFC 3339, when the command started
+	Micros   int64    `json:"duration_us"`
+	Client   string   `json:"client"` // remote address, or the peer synced with
+	Source   string   `json:"source"` // client, peer or sync
+	Cmd      string   `json:"cmd"`
+	Args     []string `json:"args"`
+	Redacted bool     `json:"redacted,omitempty"` // secret arguments left out
+}
+
+// slowLog keeps the last entries in a ring buffer
+type slowLog struct {
+	mu      sync.Mutex
+	entries []slowEntry // ring, oldest at next once full
+	next    int
+	full    bool
+	lastID  int64
+}
+
+func newSlowLog(size int) *slowLog {
+	return &slowLog{entries: make([]slowEntry, max(size, 1))}
+}
+
+// add - record an entry, dropping the oldest once the log is full
+func (l *slowLog) add(e slowEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	e.ID = l.lastID
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// len - entries in the log
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.full {
+		return len(l.entries)
+	}
+	return l.next
+}
+
+// get - up to n entries, newest first
+func (l *slowLog) get(n int) []slowEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := l.next
+	if l.full {
+		size = len(l.entries)
+	}
+	n = min(n, size)
+	out := make([]slowEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.entries)
+	l.next, l.full = 0, false
+}
+
+// recordSlow - add a command to the slow log if it took at least the
+// threshold; a negative threshold turns the slow log off
+func (srv *Server) recordSlow(source, client, cmd string, args []string, start time.Time, took time.Duration) {
+	threshold := srv.settings.SlowLogThreshold
+	if threshold < 0 || took < threshold {
+		return
+	}
+
+	e := slowEntry{
+		Time:   start.UTC().Format(time.RFC3339Nano),
+		Micros: took.Microseconds(),
+		Client: client,
+		Source: source,
+		Cmd:    cmd,
+		Args:   truncateArgs(args),
+	}
+	// Passwords and handshakes stay out of the slow log, like out of the log
+	e.Args, e.Redacted = hideSecrets(cmd, e.Args)
+	srv.slowLog.add(e)
+}
+
+// hideSecrets - the arguments of cmd that may be shown outside the log,
+// and whether any were left out
+func hideSecrets(cmd string, args []string) ([]string, bool) {
+	switch cmd {
+	case "AUTH":
+		return []string{}, len(args) > 0
+	case "PEER", "ACL":
+		// Keep the subcommand only
+		return args[:min(len(args), 1)], len(args) > 1
+	}
+	return args, false
+}
+
+// truncateArgs - args cut down to what a slow log entry keeps
+func truncateArgs(args []string) []string {
+	out := make([]string, 0, min(len(args), slowLogMaxArgs+1))
+	for i, arg := range args {
+		if i == slowLogMaxArgs {
+			out = append(out, fmt.Sprintf("... (%d more arguments)", len(args)-i))
+			break
+		}
+		if len(arg) > slowLogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowLogMaxArgLen], len(arg)-slowLogMaxArgLen)
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// handleSlowLog - SLOWLOG GET [count] | SLOWLOG LEN | SLOWLOG RESET
+func (srv *Server) handleSlowLog(w io.Writer, args []string) {
+	const usage = "Usage: SLOWLOG GET [count] | SLOWLOG LEN | SLOWLOG RESET"
+	if len(args) == 0 {
+		replyError(w, ErrCodeSyntax, usage)
+		return
+	}
+
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "GET" && len(args) <= 2:
+		n := 10
+		if len(args) == 2 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+				replyError(w, ErrCodeSyntax, usage)
+				return
+			}
+		}
+		out, _ := json.Marshal(srv.slowLog.get(n))
+		replyValue(w, string(out))
+	case sub == "LEN" && len(args) == 1:
+		replyValue(w, srv.slowLog.len())
+	case sub == "RESET" && len(args) == 1:
+		srv.slowLog.reset()
+		replyValue(w, "OK")
+	default:
+		replyError(w, ErrCodeSyntax, usage)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestSlowLogRing(t *testing.T) {
+	l := newSlowLog(3)
+	for i := 0; i < 5; i++ {
+		l.add(slowEntry{Cmd: fmt.Sprintf("CMD%d", i)})
+	}
+	if l.len() != 3 {
+		t.Errorf("Expected the log to keep 3 entries, got %d", l.len())
+	}
+
+	entries := l.get(10)
+	if len(entries) != 3 || entries[0].Cmd != "CMD4" || entries[2].Cmd != "CMD2" {
+		t.Errorf("Expected the newest 3 entries, newest first, got %+v", entries)
+	}
+	if entries[0].ID != 5 {
+		t.Errorf("Expected IDs to keep counting, got %d", entries[0].ID)
+	}
+	if got := l.get(1); len(got) != 1 || got[0].Cmd != "CMD4" {
+		t.Errorf("Expected only the newest entry, got %+v", got)
+	}
+
+	l.reset()
+	if l.len() != 0 || len(l.get(10)) != 0 {
+		t.Error("Expected RESET to empty the log")
+	}
+	l.add(slowEntry{Cmd: "AFTER"})
+	if got := l.get(10); len(got) != 1 || got[0].ID != 6 {
+		t.Errorf("Expected IDs to survive a reset, got %+v", got)
+	}
+}
+
+func TestTruncateArgs(t *testing.T) {
+	args := make([]string, 40)
+	for i := range args {
+		args[i] = "a"
+	}
+	args[0] = strings.Repeat("x", 200)
+
+	out := truncateArgs(args)
+	if len(out) != slowLogMaxArgs+1 || out[slowLogMaxArgs] != "... (8 more arguments)" {
+		t.Errorf("Expected the arguments to be cut at %d, got %d: %v", slowLogMaxArgs, len(out), out[len(out)-1])
+	}
+	if !strings.HasSuffix(out[0], "... (72 more bytes)") || len(out[0]) > slowLogMaxArgLen+30 {
+		t.Errorf("Expected the long argument to be cut, got %q", out[0])
+	}
+}
+
+func TestSlowLogCommand(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Record every command
+	startTestServer(t, store.New(), WithListener(l), WithLogger(discardLogger),
+		WithSettings(Settings{SlowLogThreshold: time.Nanosecond, SlowLogMaxLen: 4}))
+	addr := l.Addr().String()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	send := sender(conn)
+
+	send("SLOWLOG RESET")
+	send("SET key " + strings.Repeat("v", 500))
+	send("AUTH admin hunter2")
+
+	var entries []slowEntry
+	if err := json.Unmarshal([]byte(send("SLOWLOG GET 3")), &entries); err != nil {
+		t.Fatalf("Expected JSON: %v", err)
+	}
+	// The RESET itself is the oldest entry
+	if len(entries) != 3 || entries[0].Cmd != "AUTH" || entries[1].Cmd != "SET" || entries[2].Cmd != "SLOWLOG" {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	auth, set := entries[0], entries[1]
+	if len(auth.Args) != 0 || !auth.Redacted {
+		t.Errorf("Expected AUTH's password to stay out of the slow log, got %+v", auth)
+	}
+	if set.Source != "client" || set.Client != conn.LocalAddr().String() || set.Time == "" || set.ID == 0 {
+		t.Errorf("Unexpected SET entry: %+v", set)
+	}
+	if len(set.Args) != 2 || !strings.Contains(set.Args[1], "more bytes") {
+		t.Errorf("Expected the value to be truncated, got %v", set.Args)
+	}
+
+	if response := send("SLOWLOG LEN"); response != "4" {
+		t.Errorf("Expected 4 entries, got %s", response)
+	}
+	if response := send("SLOWLOG FLUSH"); !strings.HasPrefix(response, "Usage: SLOWLOG") {
+		t.Errorf("Expected a usage error, got %s", response)
+	}
+}
+
+func TestSlowLogOff(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTestServer(t, store.New(), WithListener(l), WithLogger(discardLogger),
+		WithSettings(Settings{SlowLogThreshold: -1}))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	send := sender(conn)
+	send("SET a 1")
+	if response := send("SLOWLOG LEN"); response != "0" {
+		t.Errorf("Expected nothing to be recorded, got %s entries", response)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/Ahmedhossamdev/simple-kv/certs"
+	"github.com/Ahmedhossamdev/simple-kv/internal/testcerts"
+	"github.com/Ahmedhossamdev/simple-kv/kvpb"
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerTLS(t *testing.T) {
+	files := testcerts.Write(t, t.TempDir())
+	r, err := certs.New(files.Cert, files.Key, files.CA)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	startTestServer(t, store.New(), WithAddr(":9064"), WithPeers("localhost:9065"), WithTLS(r))
+	startTestServer(t, store.New(), WithAddr(":9065"), WithPeers("localhost:9064"), WithTLS(r))
+
+	time.Sleep(200 * time.Millisecond)
+
+	pem, _ := os.ReadFile(files.CA)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+
+	// Clients need no certificate of their own
+	dial := func(addr string) (*tls.Conn, *bufio.Reader) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+		if err != nil {
+			t.Fatalf("TLS dial failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn, bufio.NewReader(conn)
+	}
+	conn, reader := dial("localhost:9064")
+	conn2, reader2 := dial("localhost:9065")
+
+	send := func(conn *tls.Conn, reader *bufio.Reader, line string) string {
+		fmt.Fprintln(conn, line)
+		response, _ := reader.ReadString('\n')
+		return strings.TrimSpace(response)
+	}
+
+	value := fmt.Sprintf("v%d", time.Now().UnixNano())
+	if response := send(conn, reader, "SET secure "+value); response != "OK" {
+		t.Fatalf("Unexpected SET response: %s", response)
+	}
+
+	// Replication goes over mutual TLS
+	time.Sleep(200 * time.Millisecond)
+	if response := send(conn2, reader2, "GET secure"); response != value {
+		t.Errorf("Expected %s on node 2, got: %s", value, response)
+	}
+
+	// The right secret is not enough without a certificate signed by the CA
+	nonce, _ := strings.CutPrefix(send(conn, reader, "PEER HELLO"), "CHALLENGE ")
+	if response := send(conn, reader, "PEER AUTH "+(&peer.Client{}).Sign(nonce)); response != "ERROR: peer authentication failed" {
+		t.Errorf("Expected PEER AUTH without a client certificate to fail, got: %s", response)
+	}
+
+	if _, err := (&peer.Client{TLS: r}).Dial("localhost:9064", time.Second); err != nil {
+		t.Errorf("Peer handshake over mutual TLS failed: %v", err)
+	}
+
+	// Certificates from another CA are refused
+	other := testcerts.Write(t, t.TempDir())
+	otherCert, _ := tls.LoadX509KeyPair(other.Cert, other.Key)
+	bad, err := tls.Dial("tcp", "localhost:9064", &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		Certificates: []tls.Certificate{otherCert},
+	})
+	if err == nil {
+		fmt.Fprintln(bad, "GET secure")
+		_, err = bufio.NewReader(bad).ReadString('\n')
+		bad.Close()
+	}
+	if err == nil {
+		t.Error("Expected a certificate from another CA to be refused")
+	}
+}
+
+func TestServerTLSAPIs(t *testing.T) {
+	files := testcerts.Write(t, t.TempDir())
+	r, err := certs.New(files.Cert, files.Key, files.CA)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	s := store.New()
+	startTestServer(t, s, WithListener(listen(t)), WithHTTPAddr(":9076"), WithGRPCAddr(":9077"), WithTLS(r), WithLogger(discardLogger))
+
+	time.Sleep(200 * time.Millisecond)
+
+	pem, _ := os.ReadFile(files.CA)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+	clientTLS := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+	// HTTP is served over TLS only
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}, Timeout: 5 * time.Second}
+	resp, err := httpClient.Get("https://localhost:9076/stats")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 over HTTPS, got %d", resp.StatusCode)
+	}
+	if resp, err := http.Get("http://localhost:9076/stats"); err == nil && resp.StatusCode == http.StatusOK {
+		resp.Body.Close()
+		t.Error("Expected plaintext HTTP to be refused")
+	}
+
+	// So is gRPC
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.NewClient("localhost:9077", grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := kvpb.NewKVClient(conn).Set(ctx, &kvpb.SetRequest{Key: "k", Value: "v"}); err != nil {
+		t.Fatalf("Set over TLS failed: %v", err)
+	}
+	if value, ok := s.Get("k"); !ok || value != "v" {
+		t.Errorf("Expected the value set over gRPC, got %q", value)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// watcherBufferSize is how many events may queue up for a WATCHKEYS
+// connection before further events are dropped and reported as an overflow
+const watcherBufferSize = 1024
+
+// keyWatcher streams store change events for keys matching a pattern.
+// Events are queued by the store hook and written by a separate goroutine,
+// so a slow client never holds up writes to the store.
+type keyWatcher struct {
+	conn     net.Conn
+	pattern  string
+	cancel   func()
+	mu       sync.Mutex
+	queue    []string
+	dropped  int
+	wake     chan struct{}
+	done     chan struct{}
+	finished chan struct{}
+}
+
+func startKeyWatcher(conn net.Conn, s *store.Store, pattern string) *keyWatcher {
+	w := &keyWatcher{
+		conn:     conn,
+		pattern:  pattern,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	w.reply(frameValue(conn, "watching "+pattern))
+	w.cancel = s.Watch(w.onEvent)
+
+	go w.writeLoop()
+	return w
+}
+
+// onEvent - store hook, runs with the store lock held so it must not block
+func (w *keyWatcher) onEvent(e store.Event) {
+	if !matchPattern(w.pattern, e.Key) {
+		return
+	}
+	line, _ := json.Marshal(e)
+
+	w.mu.Lock()
+	if len(w.queue) >= watcherBufferSize {
+		w.dropped++
+	} else {
+		w.queue = append(w.queue, framePush(w.conn, string(line)))
+	}
+	w.mu.Unlock()
+
+	w.signal()
+}
+
+// reply - queue a reply line; replies are never dropped
+func (w *keyWatcher) reply(line string) {
+	w.mu.Lock()
+	w.queue = append(w.queue, line)
+	w.mu.Unlock()
+
+	w.signal()
+}
+
+func (w *keyWatcher) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop - write queued lines until the watcher is stopped
+func (w *keyWatcher) writeLoop() {
+	defer close(w.finished)
+
+	for {
+		select {
+		case <-w.wake:
+			w.flush()
+		case <-w.done:
+			w.flush()
+			return
+		}
+	}
+}
+
+// flush - write everything queued so far. Events dropped while the queue
+// was full happened after the queued ones, so the overflow signal follows
+// them and tells the client how many events it missed at that point.
+func (w *keyWatcher) flush() {
+	w.mu.Lock()
+	lines, dropped := w.queue, w.dropped
+	w.queue, w.dropped = nil, 0
+	w.mu.Unlock()
+
+	for _, line := range lines {
+		fmt.Fprintln(w.conn, line)
+	}
+	if dropped > 0 {
+		fmt.Fprintln(w.conn, framePush(w.conn, fmt.Sprintf("OVERFLOW %d", dropped)))
+	}
+}
+
+// stop - unregister from the store and flush what is left
+func (w *keyWatcher) stop() {
+	w.cancel()
+	close(w.done)
+	<-w.finished
+}
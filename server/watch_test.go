@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/peer"
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerWatchKeys(t *testing.T) {
+	s := store.New()
+
+	go New(s, WithAddr(":9043"), WithPeerSecret(testSecret)).Start()
+
+	time.Sleep(200 * time.Millisecond)
+
+	watchConn, err := net.Dial("tcp", "localhost:9043")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer watchConn.Close()
+
+	conn, err := (&peer.Client{Secret: testSecret}).Dial("localhost:9043", time.Second)
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	watchReader := bufio.NewReader(watchConn)
+	reader := bufio.NewReader(conn)
+
+	fmt.Fprintf(watchConn, "WATCHKEYS user:*\n")
+	response, _ := watchReader.ReadString('\n')
+	if strings.TrimSpace(response) != "watching user:*" {
+		t.Errorf("Unexpected WATCHKEYS response: %s", response)
+	}
+
+	fmt.Fprintf(conn, "SET other 1\n")
+	reader.ReadString('\n')
+	fmt.Fprintf(conn, "SET user:1 alice\n")
+	reader.ReadString('\n')
+
+	// Replicated writes are reported with the node they came from
+	delID := fmt.Sprintf("%d@node-7", time.Now().UnixNano())
+	fmt.Fprintf(conn, "DEL user:1|msg-id:%s|ts:%d\n", delID, time.Now().Add(time.Second).UnixNano())
+	reader.ReadString('\n')
+
+	var event store.Event
+	watchConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, _ = watchReader.ReadString('\n')
+	if err := json.Unmarshal([]byte(response), &event); err != nil {
+		t.Fatalf("Expected a JSON event, got: %s", response)
+	}
+	if event.Key != "user:1" || event.Op != store.OpSet || event.Origin == "" {
+		t.Errorf("Unexpected set event: %+v", event)
+	}
+
+	response, _ = watchReader.ReadString('\n')
+	json.Unmarshal([]byte(response), &event)
+	if event.Op != store.OpDel || event.Origin != "node-7" || event.MsgID != delID {
+		t.Errorf("Unexpected del event: %+v", event)
+	}
+
+	fmt.Fprintf(watchConn, "UNWATCHKEYS\n")
+	response, _ = watchReader.ReadString('\n')
+	if strings.TrimSpace(response) != "unwatched" {
+		t.Errorf("Unexpected UNWATCHKEYS response: %s", response)
+	}
+}
+
+func TestKeyWatcherOverflow(t *testing.T) {
+	s := store.New()
+
+	// net.Pipe is unbuffered, so the writer blocks until the test reads
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	w := startKeyWatcher(server, s, "*")
+	reader := bufio.NewReader(client)
+	reader.ReadString('\n') // watching *
+
+	// The first event blocks the writer until we start reading
+	timestamp := time.Now().UnixNano()
+	s.Set("k-first", "v", timestamp, "msg-first")
+	time.Sleep(50 * time.Millisecond)
+
+	total := watcherBufferSize + 50
+	for i := 0; i < total; i++ {
+		s.Set(fmt.Sprintf("k%d", i), "v", timestamp, fmt.Sprintf("msg-%d", i))
+	}
+
+	reader.ReadString('\n') // k-first
+
+	events, overflow := 0, 0
+	for events+overflow < total {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if strings.HasPrefix(line, "OVERFLOW") {
+			fmt.Sscanf(line, "OVERFLOW %d", &overflow)
+			continue
+		}
+		events++
+	}
+
+	if overflow == 0 {
+		t.Error("Expected an OVERFLOW signal")
+	}
+	if events+overflow != total {
+		t.Errorf("Expected %d events and dropped events in total, got %d + %d", total, events, overflow)
+	}
+
+	go reader.ReadString('\n')
+	w.stop()
+}
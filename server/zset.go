@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+// handleZSetCommand - handle ZADD, ZREM, ZSCORE, ZRANK, ZRANGE,
+// ZRANGEBYSCORE and ZINCRBY
+//
+// Like hashes, writes are applied locally before being broadcast and
+// ZINCRBY is replicated as a ZADD of the resulting score.
+func (srv *Server) handleZSetCommand(conn net.Conn, cmd string, args []string, msgID string, timestamp int64) {
+	s := srv.store
+	replicated := msgID != ""
+	if !replicated {
+		msgID = s.NewMsgID()
+		timestamp = srv.now().UnixNano()
+	}
+
+	switch cmd {
+	case "ZADD":
+		if len(args) < 3 || len(args)%2 != 1 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZADD key score member [score member ...]")
+			return
+		}
+
+		members := make(map[string]float64)
+		for i := 1; i < len(args); i += 2 {
+			score, err := parseScore(args[i])
+			if err != nil {
+				replyError(conn, ErrCodeNotFloat, "score is not a valid float")
+				return
+			}
+			members[args[i+1]] = score
+		}
+
+		added, err := s.ZAdd(args[0], members, timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("ZADD %s|msg-id:%s|ts:%d", strings.Join(args, " "), msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, added)
+
+	case "ZREM":
+		if len(args) < 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZREM key member [member ...]")
+			return
+		}
+
+		removed, err := s.ZRem(args[0], args[1:], timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("ZREM %s|msg-id:%s|ts:%d", strings.Join(args, " "), msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, removed)
+
+	case "ZINCRBY":
+		if len(args) != 3 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZINCRBY key increment member")
+			return
+		}
+
+		delta, err := parseScore(args[1])
+		if err != nil {
+			replyError(conn, ErrCodeNotFloat, "increment is not a valid float")
+			return
+		}
+
+		key, member := args[0], args[2]
+		score, err := s.ZIncrBy(key, member, delta, timestamp, msgID)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+
+		if !replicated {
+			line := fmt.Sprintf("ZADD %s %s %s|msg-id:%s|ts:%d", key, formatScore(score), member, msgID, timestamp)
+			srv.broadcast(line)
+		}
+		replyValue(conn, formatScore(score))
+
+	case "ZSCORE":
+		if len(args) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZSCORE key member")
+			return
+		}
+
+		score, ok, err := s.ZScore(args[0], args[1])
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		if ok {
+			replyValue(conn, formatScore(score))
+		} else {
+			replyNull(conn, "Member not found")
+		}
+
+	case "ZRANK":
+		if len(args) != 2 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZRANK key member")
+			return
+		}
+
+		rank, ok, err := s.ZRank(args[0], args[1])
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		if ok {
+			replyValue(conn, rank)
+		} else {
+			replyNull(conn, "Member not found")
+		}
+
+	case "ZRANGE":
+		if len(args) < 3 || len(args) > 4 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZRANGE key start stop [WITHSCORES]")
+			return
+		}
+
+		start, err1 := strconv.Atoi(args[1])
+		stop, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			replyError(conn, ErrCodeSyntax, "start and stop must be integers")
+			return
+		}
+		withScores := len(args) == 4
+		if withScores && strings.ToUpper(args[3]) != "WITHSCORES" {
+			replyError(conn, ErrCodeSyntax, "Usage: ZRANGE key start stop [WITHSCORES]")
+			return
+		}
+
+		members, err := s.ZRange(args[0], start, stop)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		writeScoredMembers(conn, members, withScores)
+
+	case "ZRANGEBYSCORE":
+		if len(args) < 3 {
+			replyError(conn, ErrCodeSyntax, "Usage: ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]")
+			return
+		}
+
+		min, err1 := parseScoreBound(args[1])
+		max, err2 := parseScoreBound(args[2])
+		if err1 != nil || err2 != nil {
+			replyError(conn, ErrCodeSyntax, "min and max must be floats, -inf, +inf or (exclusive")
+			return
+		}
+
+		withScores := false
+		offset, count := 0, -1
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "WITHSCORES":
+				withScores = true
+			case "LIMIT":
+				if i+2 >= len(args) {
+					replyError(conn, ErrCodeSyntax, "Usage: ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]")
+					return
+				}
+				var err error
+				if offset, err = strconv.Atoi(args[i+1]); err == nil {
+					count, err = strconv.Atoi(args[i+2])
+				}
+				if err != nil {
+					replyError(conn, ErrCodeSyntax, "offset and count must be integers")
+					return
+				}
+				if offset < 0 {
+					replyError(conn, ErrCodeSyntax, "offset must not be negative")
+					return
+				}
+				i += 2
+			default:
+				replyError(conn, ErrCodeSyntax, "Usage: ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]")
+				return
+			}
+		}
+
+		members, err := s.ZRangeByScore(args[0], min, max, offset, count)
+		if err != nil {
+			replyStoreError(conn, err)
+			return
+		}
+		writeScoredMembers(conn, members, withScores)
+	}
+}
+
+// writeScoredMembers - write members as a JSON array, with scores if asked
+func writeScoredMembers(conn net.Conn, members []store.ScoredMember, withScores bool) {
+	var out []byte
+	if withScores {
+		out, _ = json.Marshal(members)
+	} else {
+		names := make([]string, len(members))
+		for i, m := range members {
+			names[i] = m.Member
+		}
+		out, _ = json.Marshal(names)
+	}
+	replyValue(conn, string(out))
+}
+
+// parseScoreBound - parse a range bound such as 10, (10, -inf or +inf
+func parseScoreBound(arg string) (store.ScoreBound, error) {
+	switch strings.ToLower(arg) {
+	case "-inf":
+		return store.MinScore, nil
+	case "+inf", "inf":
+		return store.MaxScore, nil
+	}
+
+	bound := store.ScoreBound{}
+	if strings.HasPrefix(arg, "(") {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return bound, err
+	}
+	if math.IsNaN(value) {
+		return bound, store.ErrNotFloat
+	}
+	bound.Value = value
+	return bound, nil
+}
+
+// parseScore - parse a score or increment; NaN and infinities are refused
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, store.ErrNotFloat
+	}
+	return score, nil
+}
+
+// formatScore - format a score without trailing zeros
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
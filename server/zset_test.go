@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ahmedhossamdev/simple-kv/store"
+)
+
+func TestServerZSetCommands(t *testing.T) {
+	s := store.New()
+
+	go Start(":9034", s, []string{})
+
+	time.Sleep(200 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:9034")
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// Start from a clean key in case the server is shared with an earlier run
+	fmt.Fprintf(conn, "DEL board\n")
+	reader.ReadString('\n')
+
+	fmt.Fprintf(conn, "ZADD board 10 alice 20 bob 15 carol\n")
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read ZADD response: %v", err)
+	}
+	if strings.TrimSpace(response) != "3" {
+		t.Errorf("Expected 3 added members, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "ZINCRBY board 1.5 alice\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "11.5" {
+		t.Errorf("Expected 11.5, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "ZRANK board carol\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "1" {
+		t.Errorf("Expected rank 1, got: %s", response)
+	}
+
+	fmt.Fprintf(conn, "ZRANGE board 0 -1\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != `["alice","carol","bob"]` {
+		t.Errorf("Unexpected ZRANGE response: %s", response)
+	}
+
+	fmt.Fprintf(conn, "ZRANGEBYSCORE board (11.5 +inf WITHSCORES LIMIT 0 1\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != `[{"member":"carol","score":15}]` {
+		t.Errorf("Unexpected ZRANGEBYSCORE response: %s", response)
+	}
+
+	fmt.Fprintf(conn, "ZSCORE board nobody\n")
+	response, _ = reader.ReadString('\n')
+	if strings.TrimSpace(response) != "Member not found" {
+		t.Errorf("Expected Member not found, got: %s", response)
+	}
+
+	// NaN and infinite scores are refused, so snapshots keep encoding
+	fmt.Fprintf(conn, "HELLO 2\n")
+	reader.ReadString('\n')
+	for _, cmd := range []string{"ZADD board nan dave", "ZADD board inf dave", "ZINCRBY board -inf alice"} {
+		fmt.Fprintf(conn, "%s\n", cmd)
+		response, _ = reader.ReadString('\n')
+		if !strings.HasPrefix(response, "-ERR_NOTFLOAT") {
+			t.Errorf("Expected ERR_NOTFLOAT for %q, got: %s", cmd, response)
+		}
+	}
+	// Unknown arguments and negative offsets are syntax errors, not ignored
+	for _, cmd := range []string{"ZRANGE board 0 -1 WITHSCORE", "ZRANGEBYSCORE board -inf +inf LIMIT -1 1"} {
+		fmt.Fprintf(conn, "%s\n", cmd)
+		response, _ = reader.ReadString('\n')
+		if !strings.HasPrefix(response, "-ERR_SYNTAX") {
+			t.Errorf("Expected ERR_SYNTAX for %q, got: %s", cmd, response)
+		}
+	}
+	fmt.Fprintf(conn, "SYNC\n")
+	response, _ = reader.ReadString('\n')
+	if !strings.HasPrefix(response, "+{") {
+		t.Errorf("Expected SYNC to return the snapshot, got: %s", response)
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DefaultChangeLogRetention is how many change log entries a store keeps
+const DefaultChangeLogRetention = 10000
+
+// ChangeEntry is a single entry of the change log. Value holds what changed,
+// so an entry costs the size of the write rather than of the key: the new
+// string, or "" once the key is gone; for hashes a JSON object of the fields
+// written, with null for deleted ones; for lists a JSON array of the
+// elements pushed or removed; for sorted sets a JSON object of the new
+// member scores, with null for removed members. A key replaced as a whole
+// by a sync records its whole value (an array of members for sorted sets).
+type ChangeEntry struct {
+	Seq       uint64 `json:"seq"`
+	Epoch     string `json:"epoch"`
+	Key       string `json:"key"`
+	Op        string `json:"op"`
+	Value     string `json:"value"`
+	Timestamp int64  `json:"timestamp"`
+	MsgID     string `json:"msg_id"`
+	Origin    string `json:"origin"`
+}
+
+// OffsetTruncatedError is returned when a reader asks for entries that have
+// already been dropped by the retention limit
+type OffsetTruncatedError struct {
+	Requested uint64
+	Oldest    uint64
+}
+
+func (e *OffsetTruncatedError) Error() string {
+	return fmt.Sprintf("offset %d has been truncated, oldest available offset is %d", e.Requested, e.Oldest)
+}
+
+// OffsetAheadError is returned when a reader asks for entries past the
+// next one to be written, typically with an offset from before a restart
+type OffsetAheadError struct {
+	Requested uint64
+	Next      uint64
+}
+
+func (e *OffsetAheadError) Error() string {
+	return fmt.Sprintf("offset %d is beyond the end of the change log, next offset is %d", e.Requested, e.Next)
+}
+
+// changeLog is the per-node ordered log of every change applied to the
+// store. Sequence numbers start at 1 and are local to this node; the log
+// lives in memory only, so each store gets a new epoch to tell its
+// sequence numbers from those of an earlier run.
+type changeLog struct {
+	epoch     string
+	entries   []ChangeEntry
+	nextSeq   uint64
+	retention int
+	changed   chan struct{} // closed and replaced on every append
+}
+
+func newChangeLog(retention int) *changeLog {
+	return &changeLog{
+		epoch:     uuid.New().String()[:8],
+		nextSeq:   1,
+		retention: retention,
+		changed:   make(chan struct{}),
+	}
+}
+
+// first returns the sequence number of the oldest retained entry
+func (l *changeLog) first() uint64 {
+	return l.nextSeq - uint64(len(l.entries))
+}
+
+func (l *changeLog) append(e ChangeEntry) {
+	e.Seq = l.nextSeq
+	e.Epoch = l.epoch
+	l.nextSeq++
+
+	l.entries = append(l.entries, e)
+	if len(l.entries) > l.retention {
+		l.entries = l.entries[len(l.entries)-l.retention:]
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// SetChangeLogRetention sets how many change log entries are kept
+func (s *Store) SetChangeLogRetention(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n < 1 {
+		n = 1
+	}
+	s.changes.retention = n
+	if len(s.changes.entries) > n {
+		s.changes.entries = s.changes.entries[len(s.changes.entries)-n:]
+	}
+}
+
+// ChangesSince returns up to limit change log entries starting at offset.
+// An offset of 0 starts at the oldest retained entry; offsets past the next
+// entry return an OffsetAheadError. When there is nothing new yet, the
+// returned channel is closed as soon as an entry is appended.
+func (s *Store) ChangesSince(offset uint64, limit int) ([]ChangeEntry, <-chan struct{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l := s.changes
+	first := l.first()
+	if offset == 0 {
+		offset = first
+	}
+	if offset < first {
+		return nil, nil, &OffsetTruncatedError{Requested: offset, Oldest: first}
+	}
+	if offset > l.nextSeq {
+		return nil, nil, &OffsetAheadError{Requested: offset, Next: l.nextSeq}
+	}
+
+	start := int(offset - first)
+	if start >= len(l.entries) {
+		return nil, l.changed, nil
+	}
+	end := len(l.entries)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	entries := make([]ChangeEntry, end-start)
+	copy(entries, l.entries[start:end])
+	return entries, l.changed, nil
+}
+
+// NextChangeSeq returns the sequence number the next change will get
+func (s *Store) NextChangeSeq() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes.nextSeq
+}
+
+// ChangeLogEpoch returns the epoch of the change log, which changes every
+// time the node starts
+func (s *Store) ChangeLogEpoch() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes.epoch
+}
+
+// encodeChange - v as JSON, for the change log
+func encodeChange(v any) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// encodeForLog returns the whole value of key as recorded in the change log
+// when a sync replaces it. Must be called with s.mu held.
+func (s *Store) encodeForLog(key string) string {
+	v, ok := s.data[key]
+	if !ok {
+		return ""
+	}
+
+	var out []byte
+	switch v.kind() {
+	case TypeHash:
+		fields := make(map[string]string)
+		for field, f := range v.Hash {
+			if !f.Deleted {
+				fields[field] = f.Data
+			}
+		}
+		out, _ = json.Marshal(fields)
+	case TypeList:
+		values := make([]string, len(v.List))
+		for i, item := range v.List {
+			values[i] = item.Data
+		}
+		out, _ = json.Marshal(values)
+	case TypeZSet:
+		members := make([]ScoredMember, 0, v.zindex.length)
+		for x := v.zindex.head.level[0].forward; x != nil; x = x.level[0].forward {
+			members = append(members, ScoredMember{Member: x.member, Score: x.score})
+		}
+		out, _ = json.Marshal(members)
+	default:
+		return v.Data
+	}
+	return string(out)
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStoreChangeLog(t *testing.T) {
+	s := New()
+
+	timestamp := time.Now().UnixNano()
+	s.Set("k", "v1", timestamp, "id-1@node-a")
+	s.HSet("h", map[string]string{"f": "x"}, timestamp, "id-2@node-a")
+	s.Del("k", timestamp+1, "id-3@node-b")
+
+	entries, _, err := s.ChangesSince(0, 0)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d: %v", len(entries), entries)
+	}
+	if entries[0].Seq != 1 || entries[0].Value != "v1" || entries[0].Origin != "node-a" {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Value != `{"f":"x"}` {
+		t.Errorf("Expected hash value as JSON, got %q", entries[1].Value)
+	}
+	if entries[2].Op != OpDel || entries[2].Value != "" {
+		t.Errorf("Unexpected delete entry: %+v", entries[2])
+	}
+
+	// Resuming from an offset returns only later entries
+	entries, _, _ = s.ChangesSince(3, 0)
+	if len(entries) != 1 || entries[0].Seq != 3 {
+		t.Errorf("Expected only entry 3, got %v", entries)
+	}
+
+	// Caught up readers get a channel that fires on the next change
+	entries, changed, _ := s.ChangesSince(4, 0)
+	if len(entries) != 0 {
+		t.Fatalf("Expected no entries, got %v", entries)
+	}
+	s.Set("k", "v2", timestamp+2, "id-4")
+	select {
+	case <-changed:
+	default:
+		t.Error("Expected change notification")
+	}
+
+	// Offsets that haven't been handed out yet are refused
+	var ahead *OffsetAheadError
+	if _, _, err := s.ChangesSince(6, 0); !errors.As(err, &ahead) || ahead.Next != 5 {
+		t.Errorf("Expected OffsetAheadError with next offset 5, got %v", err)
+	}
+
+	// Every store starts a new epoch
+	entries, _, _ = s.ChangesSince(4, 0)
+	if len(entries) != 1 || entries[0].Epoch != s.ChangeLogEpoch() || New().ChangeLogEpoch() == s.ChangeLogEpoch() {
+		t.Errorf("Expected entries in the store's own epoch %q, got %v", s.ChangeLogEpoch(), entries)
+	}
+}
+
+func TestStoreChangeLogRetention(t *testing.T) {
+	s := New()
+	s.SetChangeLogRetention(2)
+
+	timestamp := time.Now().UnixNano()
+	for i := 0; i < 5; i++ {
+		s.Set("k", "v", timestamp+int64(i), fmt.Sprintf("id-%d", i))
+	}
+
+	_, _, err := s.ChangesSince(1, 0)
+	var truncated *OffsetTruncatedError
+	if !errors.As(err, &truncated) {
+		t.Fatalf("Expected OffsetTruncatedError, got %v", err)
+	}
+	if truncated.Oldest != 4 {
+		t.Errorf("Expected oldest offset 4, got %d", truncated.Oldest)
+	}
+
+	entries, _, err := s.ChangesSince(0, 0)
+	if err != nil || len(entries) != 2 || entries[0].Seq != 4 {
+		t.Errorf("Expected entries 4 and 5, got %v (%v)", entries, err)
+	}
+}
+
+func TestStoreChangeLogRecordsOnlyTheChange(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	big := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		big[fmt.Sprintf("f%d", i)] = "v"
+	}
+	s.HSet("h", big, timestamp, "id-1")
+	s.HSet("h", map[string]string{"f1": "x"}, timestamp+1, "id-2")
+	s.HDel("h", []string{"f2"}, timestamp+2, "id-3")
+	s.RPush("l", []string{"a", "b"}, timestamp, "id-4")
+	s.LPop("l", timestamp+1, "id-5")
+	s.ZAdd("z", map[string]float64{"m": 1.5}, timestamp, "id-6")
+	s.ZRem("z", []string{"m"}, timestamp+1, "id-7")
+
+	entries, _, _ := s.ChangesSince(2, 0)
+	want := []string{`{"f1":"x"}`, `{"f2":null}`, `["a","b"]`, `["a"]`, `{"m":1.5}`, `{"m":null}`}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %v", len(want), entries)
+	}
+	for i, e := range entries {
+		if e.Value != want[i] {
+			t.Errorf("Entry %d (%s): expected %s, got %s", e.Seq, e.Op, want[i], e.Value)
+		}
+	}
+}
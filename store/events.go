@@ -0,0 +1,110 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Operations reported in change events
+const (
+	OpSet   = "set"
+	OpDel   = "del"
+	OpHSet  = "hset"
+	OpHDel  = "hdel"
+	OpLPush = "lpush"
+	OpRPush = "rpush"
+	OpLPop  = "lpop"
+	OpRPop  = "rpop"
+	OpLRem  = "lrem"
+	OpZAdd  = "zadd"
+	OpZRem  = "zrem"
+)
+
+// Event describes a single change to the store, whether it was made by a
+// local client, replicated from a peer or merged from a snapshot
+type Event struct {
+	Key       string `json:"key"`
+	Op        string `json:"op"`
+	Timestamp int64  `json:"timestamp"`
+	MsgID     string `json:"msg_id"`
+	Origin    string `json:"origin"`
+}
+
+// Watch registers fn to be called for every change and returns a function
+// that unregisters it. fn runs while the store lock is held so events for a
+// key are seen in the order they were applied; it must not block or call
+// back into the store.
+func (s *Store) Watch(fn func(Event)) (cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextWatchID
+	s.nextWatchID++
+	s.watchers[id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, id)
+	}
+}
+
+// notify records a change in the change log and reports it to every
+// watcher. value is what the change log records, see ChangeEntry. Must be
+// called with s.mu held.
+func (s *Store) notify(key, op string, timestamp int64, msgID, value string) {
+	origin := OriginOf(msgID)
+
+	s.changes.append(ChangeEntry{
+		Key:       key,
+		Op:        op,
+		Value:     value,
+		Timestamp: timestamp,
+		MsgID:     msgID,
+		Origin:    origin,
+	})
+
+	e := Event{
+		Key:       key,
+		Op:        op,
+		Timestamp: timestamp,
+		MsgID:     msgID,
+		Origin:    origin,
+	}
+	for _, fn := range s.watchers {
+		fn(e)
+	}
+}
+
+// SetNodeID sets the identifier embedded in msg-ids created by NewMsgID
+func (s *Store) SetNodeID(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodeID = id
+}
+
+// NodeID returns the identifier of the node owning this store
+func (s *Store) NodeID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodeID
+}
+
+// NewMsgID returns a new msg-id of the form uuid@node-id. Like an email
+// Message-ID it tells every node where a write originally came from.
+func (s *Store) NewMsgID() string {
+	id := uuid.New().String()
+	if nodeID := s.NodeID(); nodeID != "" {
+		id += "@" + nodeID
+	}
+	return id
+}
+
+// OriginOf returns the node that created msgID, or "" if it isn't known
+func OriginOf(msgID string) string {
+	if i := strings.IndexByte(msgID, '@'); i >= 0 {
+		return msgID[i+1:]
+	}
+	return ""
+}
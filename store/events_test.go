@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreWatchEvents(t *testing.T) {
+	s := New()
+
+	var events []Event
+	cancel := s.Watch(func(e Event) {
+		events = append(events, e)
+	})
+
+	timestamp := time.Now().UnixNano()
+	s.Set("k", "v", timestamp, "id-1@node-a")
+	s.Set("k", "stale", timestamp-1, "id-2@node-b") // loses LWW, no event
+	s.HSet("h", map[string]string{"f": "v"}, timestamp, "id-3@node-a")
+	s.Del("k", timestamp+1, "id-4@node-b")
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d: %v", len(events), events)
+	}
+	if events[0].Op != OpSet || events[0].Key != "k" || events[0].Origin != "node-a" {
+		t.Errorf("Unexpected first event: %+v", events[0])
+	}
+	if events[1].Op != OpHSet {
+		t.Errorf("Expected hset event, got %+v", events[1])
+	}
+	if events[2].Op != OpDel || events[2].Origin != "node-b" || events[2].MsgID != "id-4@node-b" {
+		t.Errorf("Unexpected delete event: %+v", events[2])
+	}
+
+	cancel()
+	s.Set("other", "v", timestamp, "id-5")
+	if len(events) != 3 {
+		t.Error("Expected no events after cancel")
+	}
+}
+
+func TestStoreWatchSnapshotEvents(t *testing.T) {
+	source := New()
+	source.SetNodeID("node-a")
+	source.Set("synced", "v", time.Now().UnixNano(), source.NewMsgID())
+
+	snapshot, err := source.GetSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+
+	s := New()
+	var events []Event
+	s.Watch(func(e Event) {
+		events = append(events, e)
+	})
+
+	if err := s.ApplySnapshot(snapshot); err != nil {
+		t.Fatalf("Failed to apply snapshot: %v", err)
+	}
+
+	if len(events) != 1 || events[0].Key != "synced" || events[0].Origin != "node-a" {
+		t.Errorf("Expected one event from node-a for the synced key, got %v", events)
+	}
+}
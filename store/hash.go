@@ -0,0 +1,282 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// ErrNotInteger is returned by HIncrBy when the field does not hold an integer
+var ErrNotInteger = errors.New("hash value is not an integer")
+
+// ErrOverflow is returned by HIncrBy when the result doesn't fit in an int64
+var ErrOverflow = errors.New("increment or decrement would overflow")
+
+// HashField is a single field of a hash. Every field carries its own
+// timestamp so concurrent updates to different fields on different nodes
+// merge field by field instead of overwriting the whole hash. Deleted
+// fields are kept as tombstones so an older write can't bring them back.
+type HashField struct {
+	Data      string `json:"data"`
+	Timestamp int64  `json:"timestamp"`
+	MsgID     string `json:"msg_id"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// HSet sets fields of the hash stored at key and returns how many fields
+// were newly created. A key holding another type returns ErrWrongType;
+// replicated writes that lose that race are reconciled by the next sync.
+func (s *Store) HSet(key string, fields map[string]string, timestamp int64, msgID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastSeenMsgID[msgID] {
+		return 0, nil
+	}
+
+	current, exists := s.data[key]
+	if exists && current.kind() != TypeHash {
+		return 0, ErrWrongType
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	if !exists {
+		current = s.newHash(key)
+	}
+
+	added, changes := 0, make(map[string]*string)
+	for field, value := range fields {
+		existing, ok := current.Hash[field]
+		if ok && timestamp <= existing.Timestamp {
+			continue
+		}
+		if !ok || existing.Deleted {
+			added++
+		}
+		changes[field] = &value
+		current.Hash[field] = HashField{
+			Data:      value,
+			Timestamp: timestamp,
+			MsgID:     msgID,
+		}
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeHash(key, current)
+	if len(changes) > 0 {
+		s.notify(key, OpHSet, timestamp, msgID, encodeChange(changes))
+	}
+
+	return added, nil
+}
+
+// HGet returns the value of a single hash field
+func (s *Store) HGet(key, field string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, exists := s.data[key]
+	if !exists {
+		return "", false, nil
+	}
+	if current.kind() != TypeHash {
+		return "", false, ErrWrongType
+	}
+
+	f, ok := current.Hash[field]
+	if !ok || f.Deleted {
+		return "", false, nil
+	}
+	return f.Data, true, nil
+}
+
+// HGetAll returns every live field of the hash stored at key
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]string)
+
+	current, exists := s.data[key]
+	if !exists {
+		return result, nil
+	}
+	if current.kind() != TypeHash {
+		return nil, ErrWrongType
+	}
+
+	for field, f := range current.Hash {
+		if !f.Deleted {
+			result[field] = f.Data
+		}
+	}
+	return result, nil
+}
+
+// HDel removes fields from the hash stored at key and returns how many
+// live fields were removed. The key is dropped once no live fields remain.
+func (s *Store) HDel(key string, fields []string, timestamp int64, msgID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastSeenMsgID[msgID] {
+		return 0, nil
+	}
+
+	current, exists := s.data[key]
+	if !exists {
+		s.lastSeenMsgID[msgID] = true
+		return 0, nil
+	}
+	if current.kind() != TypeHash {
+		return 0, ErrWrongType
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	removed, changes := 0, make(map[string]*string)
+	for _, field := range fields {
+		existing, ok := current.Hash[field]
+		if ok && timestamp <= existing.Timestamp {
+			continue
+		}
+		if ok && !existing.Deleted {
+			removed++
+			changes[field] = nil
+		}
+		current.Hash[field] = HashField{
+			Timestamp: timestamp,
+			MsgID:     msgID,
+			Deleted:   true,
+		}
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeHash(key, current)
+	if removed > 0 {
+		s.notify(key, OpHDel, timestamp, msgID, encodeChange(changes))
+	}
+
+	return removed, nil
+}
+
+// HIncrBy adds delta to the integer stored in a hash field and returns the
+// new value. Missing fields start at zero.
+func (s *Store) HIncrBy(key, field string, delta int64, timestamp int64, msgID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.data[key]
+	if exists && current.kind() != TypeHash {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		current = s.newHash(key)
+	}
+
+	var n int64
+	if f, ok := current.Hash[field]; ok && !f.Deleted {
+		parsed, err := strconv.ParseInt(f.Data, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		n = parsed
+	}
+
+	if s.lastSeenMsgID[msgID] {
+		return n, nil
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	n += delta
+	changes := make(map[string]*string)
+	if existing, ok := current.Hash[field]; !ok || timestamp > existing.Timestamp {
+		value := strconv.FormatInt(n, 10)
+		current.Hash[field] = HashField{
+			Data:      value,
+			Timestamp: timestamp,
+			MsgID:     msgID,
+		}
+		changes[field] = &value
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeHash(key, current)
+	if len(changes) > 0 {
+		s.notify(key, OpHSet, timestamp, msgID, encodeChange(changes))
+	}
+
+	return n, nil
+}
+
+// mergeHash merges an incoming hash into the current one field by field.
+// Must be called with s.mu held.
+func (s *Store) mergeHash(key string, current, incoming Value) {
+	changes := make(map[string]*string)
+	for field, f := range incoming.Hash {
+		existing, ok := current.Hash[field]
+		if !ok || f.Timestamp > existing.Timestamp {
+			current.Hash[field] = f
+			if !f.Deleted {
+				changes[field] = &f.Data
+			} else if ok && !existing.Deleted {
+				changes[field] = nil
+			}
+			if f.MsgID != "" {
+				s.lastSeenMsgID[f.MsgID] = true
+			}
+		}
+	}
+
+	if incoming.Timestamp > current.Timestamp {
+		current.Timestamp = incoming.Timestamp
+		current.MsgID = incoming.MsgID
+	}
+	s.storeHash(key, current)
+	if len(changes) > 0 {
+		s.notify(key, OpHSet, incoming.Timestamp, incoming.MsgID, encodeChange(changes))
+	}
+}
+
+// newHash returns the hash to write to a missing key: the tombstones left
+// by its deleted fields, if any, or an empty one. Must be called with s.mu
+// held.
+func (s *Store) newHash(key string) Value {
+	if v, ok := s.tombstones[key]; ok && v.kind() == TypeHash {
+		return v
+	}
+	return Value{Type: TypeHash, Hash: make(map[string]HashField)}
+}
+
+// storeHash writes a hash back. Once no live fields remain the key is
+// dropped, but its tombstones are kept for a while. Must be called with
+// s.mu held.
+func (s *Store) storeHash(key string, v Value) {
+	if hasLiveFields(v) {
+		s.data[key] = v
+		delete(s.tombstones, key)
+		return
+	}
+	s.bury(key, v)
+}
+
+// hasLiveFields reports whether any field of a hash isn't deleted
+func hasLiveFields(v Value) bool {
+	for _, f := range v.Hash {
+		if !f.Deleted {
+			return true
+		}
+	}
+	return false
+}
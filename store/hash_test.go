@@ -0,0 +1,180 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHashBasicOperations(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	added, err := s.HSet("user:1", map[string]string{"name": "alice", "age": "30"}, timestamp, "msg-1")
+	if err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("Expected 2 new fields, got %d", added)
+	}
+
+	value, ok, err := s.HGet("user:1", "name")
+	if err != nil || !ok || value != "alice" {
+		t.Errorf("Expected 'alice', got '%s' (ok=%v, err=%v)", value, ok, err)
+	}
+
+	if s.Type("user:1") != TypeHash {
+		t.Errorf("Expected type hash, got %s", s.Type("user:1"))
+	}
+
+	removed, err := s.HDel("user:1", []string{"age", "missing"}, timestamp+1, "msg-2")
+	if err != nil {
+		t.Fatalf("HDel failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 removed field, got %d", removed)
+	}
+
+	fields, _ := s.HGetAll("user:1")
+	if len(fields) != 1 || fields["name"] != "alice" {
+		t.Errorf("Unexpected fields after HDel: %v", fields)
+	}
+
+	// Removing the last field drops the key
+	s.HDel("user:1", []string{"name"}, timestamp+2, "msg-3")
+	if s.Type("user:1") != TypeNone {
+		t.Errorf("Expected key to be removed with its last field, got type %s", s.Type("user:1"))
+	}
+}
+
+func TestHashWrongType(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	s.Set("plain", "value", timestamp, "msg-1")
+
+	if _, err := s.HSet("plain", map[string]string{"f": "v"}, timestamp+1, "msg-2"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from HSet on a string, got %v", err)
+	}
+
+	s.HSet("hash", map[string]string{"f": "v"}, timestamp, "msg-3")
+	if _, ok := s.Get("hash"); ok {
+		t.Error("Expected Get to ignore a hash key")
+	}
+}
+
+func TestHashIncrBy(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	n, err := s.HIncrBy("counters", "hits", 5, timestamp, "msg-1")
+	if err != nil || n != 5 {
+		t.Fatalf("Expected 5, got %d (err=%v)", n, err)
+	}
+
+	n, _ = s.HIncrBy("counters", "hits", -2, timestamp+1, "msg-2")
+	if n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+
+	s.HSet("counters", map[string]string{"name": "abc"}, timestamp+2, "msg-3")
+	if _, err := s.HIncrBy("counters", "name", 1, timestamp+3, "msg-4"); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger, got %v", err)
+	}
+
+	s.HSet("counters", map[string]string{"big": strconv.FormatInt(math.MaxInt64, 10)}, timestamp+4, "msg-5")
+	if _, err := s.HIncrBy("counters", "big", 1, timestamp+5, "msg-6"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if v, _, _ := s.HGet("counters", "big"); v != strconv.FormatInt(math.MaxInt64, 10) {
+		t.Errorf("Expected the field to be left alone on overflow, got %s", v)
+	}
+}
+
+func TestHashFieldLevelMerge(t *testing.T) {
+	s1 := New()
+	s2 := New()
+	timestamp := time.Now().UnixNano()
+
+	// Both nodes start with the same hash
+	s1.HSet("profile", map[string]string{"name": "alice", "city": "cairo"}, timestamp, "msg-1")
+	s2.HSet("profile", map[string]string{"name": "alice", "city": "cairo"}, timestamp, "msg-1")
+
+	// Concurrent updates to different fields on different nodes
+	s1.HSet("profile", map[string]string{"name": "alicia"}, timestamp+10, "msg-2")
+	s2.HSet("profile", map[string]string{"city": "giza"}, timestamp+20, "msg-3")
+	s2.HDel("profile", []string{"name"}, timestamp+5, "msg-4")
+
+	snapshot, err := s2.GetSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+	if err := s1.ApplySnapshot(snapshot); err != nil {
+		t.Fatalf("Failed to apply snapshot: %v", err)
+	}
+
+	fields, _ := s1.HGetAll("profile")
+	if fields["name"] != "alicia" {
+		t.Errorf("Newer local field should survive the older remote delete, got %v", fields)
+	}
+	if fields["city"] != "giza" {
+		t.Errorf("Expected remote field update to be merged, got %v", fields)
+	}
+}
+
+func TestHashTombstonesOutliveKey(t *testing.T) {
+	peer := New()
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	peer.HSet("h", map[string]string{"f": "old"}, timestamp, "msg-1")
+	stale, _ := peer.GetSnapshot()
+
+	s.HSet("h", map[string]string{"f": "v"}, timestamp+1, "msg-2")
+	s.HDel("h", []string{"f"}, timestamp+2, "msg-3")
+	if s.Type("h") != TypeNone {
+		t.Fatalf("Expected the key to be gone, got type %s", s.Type("h"))
+	}
+
+	// An older snapshot must not bring the deleted field back
+	if err := s.ApplySnapshot(stale); err != nil {
+		t.Fatalf("Failed to apply snapshot: %v", err)
+	}
+	if s.Type("h") != TypeNone {
+		fields, _ := s.HGetAll("h")
+		t.Errorf("Deleted field came back from an older snapshot: %v", fields)
+	}
+
+	// The tombstones travel with snapshots so the peer drops the field too
+	snapshot, _ := s.GetSnapshot()
+	peer.ApplySnapshot(snapshot)
+	if peer.Type("h") != TypeNone {
+		t.Errorf("Expected the peer to delete the hash, got type %s", peer.Type("h"))
+	}
+
+	// Writes newer than the tombstones bring the hash back
+	s.HSet("h", map[string]string{"f": "new"}, timestamp+3, "msg-4")
+	if v, ok, _ := s.HGet("h", "f"); !ok || v != "new" {
+		t.Errorf("Expected f=new, got %q (found=%v)", v, ok)
+	}
+}
+
+func TestHashTombstonesPruned(t *testing.T) {
+	s := New()
+	s.SetTombstoneRetention(time.Hour)
+	timestamp := time.Now().UnixNano()
+
+	s.HSet("h", map[string]string{"f": "v"}, timestamp, "msg-1")
+	s.HDel("h", []string{"f"}, timestamp+1, "msg-2")
+
+	// Burying another hash two hours later prunes the first one's tombstones
+	s.HSet("other", map[string]string{"f": "v"}, timestamp+int64(2*time.Hour), "msg-3")
+	s.HDel("other", []string{"f"}, timestamp+int64(2*time.Hour)+1, "msg-4")
+
+	s.HSet("h", map[string]string{"f": "old"}, timestamp, "msg-5")
+	if v, ok, _ := s.HGet("h", "f"); !ok || v != "old" {
+		t.Errorf("Expected pruned tombstones to no longer shadow writes, got %q (found=%v)", v, ok)
+	}
+}
@@ -0,0 +1,284 @@
+package store
+
+import "fmt"
+
+// ListItem is a single list element. The ID is derived from the msg-id of
+// the push that created it, so every node assigns the same ID and a pop can
+// be replicated as the removal of that exact element.
+type ListItem struct {
+	ID   string `json:"id"`
+	Data string `json:"data"`
+}
+
+// LPush prepends values to the list stored at key and returns its new length
+func (s *Store) LPush(key string, values []string, timestamp int64, msgID string) (int, error) {
+	return s.push(key, values, true, timestamp, msgID)
+}
+
+// RPush appends values to the list stored at key and returns its new length
+func (s *Store) RPush(key string, values []string, timestamp int64, msgID string) (int, error) {
+	return s.push(key, values, false, timestamp, msgID)
+}
+
+func (s *Store) push(key string, values []string, left bool, timestamp int64, msgID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.data[key]
+	if exists && current.kind() != TypeList {
+		return 0, ErrWrongType
+	}
+	if s.lastSeenMsgID[msgID] {
+		return len(current.List), nil
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	if !exists {
+		current = Value{Type: TypeList}
+	}
+
+	for i, v := range values {
+		item := ListItem{ID: fmt.Sprintf("%s:%d", msgID, i), Data: v}
+		if left {
+			current.List = append([]ListItem{item}, current.List...)
+		} else {
+			current.List = append(current.List, item)
+		}
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.data[key] = current
+	s.notifyListWaiters(key)
+	if left {
+		s.notify(key, OpLPush, timestamp, msgID, encodeChange(values))
+	} else {
+		s.notify(key, OpRPush, timestamp, msgID, encodeChange(values))
+	}
+
+	return len(current.List), nil
+}
+
+// LPop removes and returns the first element of the list stored at key
+func (s *Store) LPop(key string, timestamp int64, msgID string) (ListItem, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pop(key, true, timestamp, msgID)
+}
+
+// RPop removes and returns the last element of the list stored at key
+func (s *Store) RPop(key string, timestamp int64, msgID string) (ListItem, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pop(key, false, timestamp, msgID)
+}
+
+// pop must be called with s.mu held
+func (s *Store) pop(key string, left bool, timestamp int64, msgID string) (ListItem, bool, error) {
+	current, exists := s.data[key]
+	if !exists {
+		return ListItem{}, false, nil
+	}
+	if current.kind() != TypeList {
+		return ListItem{}, false, ErrWrongType
+	}
+	if s.lastSeenMsgID[msgID] {
+		return ListItem{}, false, nil
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	var item ListItem
+	if left {
+		item = current.List[0]
+		current.List = current.List[1:]
+	} else {
+		item = current.List[len(current.List)-1]
+		current.List = current.List[:len(current.List)-1]
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeList(key, current)
+	if left {
+		s.notify(key, OpLPop, timestamp, msgID, encodeChange([]string{item.Data}))
+	} else {
+		s.notify(key, OpRPop, timestamp, msgID, encodeChange([]string{item.Data}))
+	}
+
+	return item, true, nil
+}
+
+// PopOrWait pops from the first non-empty list among keys. When every list
+// is empty it registers and returns a channel that is closed on the next
+// push to any of the keys; callers must pass it to CancelWait if they stop
+// waiting before it fires.
+func (s *Store) PopOrWait(keys []string, left bool, timestamp int64, msgID string) (string, ListItem, <-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		item, ok, err := s.pop(key, left, timestamp, msgID)
+		if err != nil {
+			return "", ListItem{}, nil, err
+		}
+		if ok {
+			return key, item, nil, nil
+		}
+	}
+
+	wait := make(chan struct{})
+	for _, key := range keys {
+		if s.listWaiters[key] == nil {
+			s.listWaiters[key] = make(map[chan struct{}]bool)
+		}
+		s.listWaiters[key][wait] = true
+	}
+	return "", ListItem{}, wait, nil
+}
+
+// CancelWait unregisters a channel returned by PopOrWait
+func (s *Store) CancelWait(keys []string, wait <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		for ch := range s.listWaiters[key] {
+			if ch == wait {
+				delete(s.listWaiters[key], ch)
+			}
+		}
+		if len(s.listWaiters[key]) == 0 {
+			delete(s.listWaiters, key)
+		}
+	}
+}
+
+// LRemIDs removes the elements with the given IDs. It is how pops performed
+// on another node are replicated: peers drop the exact element that was
+// popped rather than whatever happens to be at the head of their copy.
+func (s *Store) LRemIDs(key string, ids []string, timestamp int64, msgID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastSeenMsgID[msgID] {
+		return nil
+	}
+
+	current, exists := s.data[key]
+	if !exists {
+		s.lastSeenMsgID[msgID] = true
+		return nil
+	}
+	if current.kind() != TypeList {
+		return ErrWrongType
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	kept := make([]ListItem, 0, len(current.List))
+	var removed []string
+	for _, item := range current.List {
+		if remove[item.ID] {
+			removed = append(removed, item.Data)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	current.List = kept
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeList(key, current)
+	if len(removed) > 0 {
+		s.notify(key, OpLRem, timestamp, msgID, encodeChange(removed))
+	}
+
+	return nil
+}
+
+// LRange returns the elements between start and stop inclusive. Negative
+// indexes count from the end of the list.
+func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []string{}
+
+	current, exists := s.data[key]
+	if !exists {
+		return result, nil
+	}
+	if current.kind() != TypeList {
+		return nil, ErrWrongType
+	}
+
+	n := len(current.List)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	for i := start; i <= stop; i++ {
+		result = append(result, current.List[i].Data)
+	}
+	return result, nil
+}
+
+// LLen returns the length of the list stored at key
+func (s *Store) LLen(key string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, exists := s.data[key]
+	if !exists {
+		return 0, nil
+	}
+	if current.kind() != TypeList {
+		return 0, ErrWrongType
+	}
+	return len(current.List), nil
+}
+
+// storeList writes a list back, dropping the key when it is empty.
+// Must be called with s.mu held.
+func (s *Store) storeList(key string, v Value) {
+	if len(v.List) == 0 {
+		delete(s.data, key)
+		return
+	}
+	s.data[key] = v
+}
+
+// notifyListWaiters wakes every PopOrWait caller blocked on key.
+// Must be called with s.mu held.
+func (s *Store) notifyListWaiters(key string) {
+	for ch := range s.listWaiters[key] {
+		close(ch)
+		// A channel may be registered under several keys
+		for k, waiters := range s.listWaiters {
+			delete(waiters, ch)
+			if len(waiters) == 0 {
+				delete(s.listWaiters, k)
+			}
+		}
+	}
+	delete(s.listWaiters, key)
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestListPushPop(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	s.RPush("jobs", []string{"b", "c"}, timestamp, "msg-1")
+	length, err := s.LPush("jobs", []string{"a"}, timestamp+1, "msg-2")
+	if err != nil || length != 3 {
+		t.Fatalf("Expected length 3, got %d (err=%v)", length, err)
+	}
+
+	values, _ := s.LRange("jobs", 0, -1)
+	if len(values) != 3 || values[0] != "a" || values[2] != "c" {
+		t.Errorf("Unexpected list contents: %v", values)
+	}
+
+	item, ok, _ := s.LPop("jobs", timestamp+2, "msg-3")
+	if !ok || item.Data != "a" {
+		t.Errorf("Expected to pop 'a', got '%s'", item.Data)
+	}
+
+	item, ok, _ = s.RPop("jobs", timestamp+3, "msg-4")
+	if !ok || item.Data != "c" {
+		t.Errorf("Expected to pop 'c', got '%s'", item.Data)
+	}
+
+	s.LPop("jobs", timestamp+4, "msg-5")
+	if s.Type("jobs") != TypeNone {
+		t.Error("Expected empty list to be removed")
+	}
+
+	s.Set("plain", "value", timestamp, "msg-6")
+	if _, err := s.LPush("plain", []string{"x"}, timestamp+1, "msg-7"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestListReplicatedPop(t *testing.T) {
+	s1 := New()
+	s2 := New()
+	timestamp := time.Now().UnixNano()
+
+	// The same push applied on both nodes yields the same element IDs
+	s1.RPush("queue", []string{"one", "two"}, timestamp, "push-1")
+	s2.RPush("queue", []string{"one", "two"}, timestamp, "push-1")
+
+	item, ok, _ := s1.LPop("queue", timestamp+1, "pop-1")
+	if !ok {
+		t.Fatal("Expected pop to succeed")
+	}
+
+	// A concurrent push on s2 must not change which element gets removed
+	s2.LPush("queue", []string{"zero"}, timestamp+1, "push-2")
+	if err := s2.LRemIDs("queue", []string{item.ID}, timestamp+2, "pop-1"); err != nil {
+		t.Fatalf("LRemIDs failed: %v", err)
+	}
+
+	values, _ := s2.LRange("queue", 0, -1)
+	if len(values) != 2 || values[0] != "zero" || values[1] != "two" {
+		t.Errorf("Expected [zero two], got %v", values)
+	}
+}
+
+func TestListPopOrWait(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	_, _, wait, err := s.PopOrWait([]string{"q1", "q2"}, true, timestamp, "pop-1")
+	if err != nil || wait == nil {
+		t.Fatalf("Expected to wait on empty lists, got err=%v", err)
+	}
+
+	go s.RPush("q2", []string{"job"}, timestamp+1, "push-1")
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second):
+		t.Fatal("Expected push to wake the waiter")
+	}
+
+	key, item, wait, _ := s.PopOrWait([]string{"q1", "q2"}, true, timestamp+2, "pop-1")
+	if wait != nil || key != "q2" || item.Data != "job" {
+		t.Errorf("Expected to pop 'job' from q2, got key=%s item=%v", key, item)
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SaveFile writes a snapshot of the store to path. The snapshot is written
+// to a temporary file first and renamed, so a crash never leaves a torn
+// file behind.
+func (s *Store) SaveFile(path string) error {
+	snapshot, err := s.GetSnapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(snapshot); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile merges a snapshot saved by SaveFile into the store. A missing
+// file is reported as an error matching fs.ErrNotExist.
+func (s *Store) LoadFile(path string) error {
+	snapshot, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return s.ApplySnapshot(snapshot)
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	s := New()
+	if err := s.LoadFile(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a missing file to be reported, got %v", err)
+	}
+
+	s.Set("name", "alice", time.Now().UnixNano(), "id-1")
+	s.HSet("user:1", map[string]string{"email": "a@example.com"}, time.Now().UnixNano(), "id-2")
+	if err := s.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+
+	restored := New()
+	if err := restored.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if value, ok := restored.Get("name"); !ok || value != "alice" {
+		t.Errorf("Expected alice, got %q", value)
+	}
+	if value, ok, _ := restored.HGet("user:1", "email"); !ok || value != "a@example.com" {
+		t.Errorf("Expected the hash to be restored, got %q", value)
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import "math/rand"
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+// skipList keeps sorted set members ordered by (score, member). Each level
+// records the span it jumps over so ranks can be computed in O(log n).
+type skipList struct {
+	head   *skipListNode
+	level  int
+	length int
+}
+
+type skipListNode struct {
+	member string
+	score  float64
+	level  []skipListLevel
+}
+
+type skipListLevel struct {
+	forward *skipListNode
+	span    int
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipListNode{level: make([]skipListLevel, skipListMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomSkipListLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+// nodeLess reports whether n sorts before (score, member)
+func nodeLess(n *skipListNode, score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+func (sl *skipList) insert(member string, score float64) {
+	var update [skipListMaxLevel]*skipListNode
+	var rank [skipListMaxLevel]int
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && nodeLess(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomSkipListLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.head
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = &skipListNode{member: member, score: score, level: make([]skipListLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+	sl.length++
+}
+
+func (sl *skipList) delete(member string, score float64) bool {
+	var update [skipListMaxLevel]*skipListNode
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && nodeLess(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	for sl.level > 1 && sl.head.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// rank returns the 0-based rank of member, or -1 if it isn't present
+func (sl *skipList) rank(member string, score float64) int {
+	rank := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(nodeLess(x.level[i].forward, score, member) ||
+				(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.head && x.member == member {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// byRank returns the node at the given 0-based rank
+func (sl *skipList) byRank(rank int) *skipListNode {
+	traversed := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank+1 {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstInRange returns the first node whose score lies within [min, max]
+func (sl *skipList) firstInRange(min, max ScoreBound) *skipListNode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !min.lessOrEqual(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !max.greaterOrEqual(x.score) {
+		return nil
+	}
+	return x
+}
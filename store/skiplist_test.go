@@ -0,0 +1,73 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkipListOrderAndRank(t *testing.T) {
+	sl := newSkipList()
+	scores := make(map[string]float64)
+
+	for i := 0; i < 500; i++ {
+		member := fmt.Sprintf("m%d", i)
+		score := float64(rand.Intn(50))
+		sl.insert(member, score)
+		scores[member] = score
+	}
+
+	// Delete every third member
+	for i := 0; i < 500; i += 3 {
+		member := fmt.Sprintf("m%d", i)
+		if !sl.delete(member, scores[member]) {
+			t.Fatalf("Expected to delete %s", member)
+		}
+		delete(scores, member)
+	}
+
+	expected := make([]ScoredMember, 0, len(scores))
+	for member, score := range scores {
+		expected = append(expected, ScoredMember{Member: member, Score: score})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Score != expected[j].Score {
+			return expected[i].Score < expected[j].Score
+		}
+		return expected[i].Member < expected[j].Member
+	})
+
+	if sl.length != len(expected) {
+		t.Fatalf("Expected length %d, got %d", len(expected), sl.length)
+	}
+
+	for i, m := range expected {
+		if rank := sl.rank(m.Member, m.Score); rank != i {
+			t.Fatalf("Expected rank %d for %s, got %d", i, m.Member, rank)
+		}
+		if node := sl.byRank(i); node == nil || node.member != m.Member {
+			t.Fatalf("Expected %s at rank %d", m.Member, i)
+		}
+	}
+
+	if sl.rank("m0", scores["m0"]) != -1 {
+		t.Error("Expected deleted member to have no rank")
+	}
+}
+
+func TestSkipListFirstInRange(t *testing.T) {
+	sl := newSkipList()
+	for i := 1; i <= 10; i++ {
+		sl.insert(fmt.Sprintf("m%02d", i), float64(i))
+	}
+
+	node := sl.firstInRange(ScoreBound{Value: 3, Exclusive: true}, MaxScore)
+	if node == nil || node.score != 4 {
+		t.Errorf("Expected first node above (3 to have score 4, got %v", node)
+	}
+
+	if node := sl.firstInRange(ScoreBound{Value: 11}, MaxScore); node != nil {
+		t.Errorf("Expected no node above 11, got %v", node.member)
+	}
+}
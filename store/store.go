@@ -2,29 +2,76 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"sync"
+	"time"
 )
 
+// Value types reported by Type. An empty Value.Type means a string so
+// snapshots from older nodes keep decoding the same way.
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeZSet   = "zset"
+)
+
+// ErrWrongType is returned when a command targets a key holding a
+// different kind of value
+var ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+
 type Store struct {
 	mu            sync.RWMutex
 	data          map[string]Value
 	lastSeenMsgID map[string]bool // for deduplication
+	listWaiters   map[string]map[chan struct{}]bool
+	watchers      map[int]func(Event)
+	nextWatchID   int
+	nodeID        string
+	changes       *changeLog
+
+	// Deleted hashes and sorted sets, kept for their tombstones
+	tombstones         map[string]Value
+	tombstoneRetention time.Duration
+	tombstonesPruned   int64
 }
 
 type Value struct {
-	Data      string `json:"data"`
-	Timestamp int64  `json:"timestamp"`
-	MsgID     string `json:"msg_id"`
+	Type      string                `json:"type,omitempty"`
+	Data      string                `json:"data"`
+	Hash      map[string]HashField  `json:"hash,omitempty"`
+	List      []ListItem            `json:"list,omitempty"`
+	ZSet      map[string]ZSetMember `json:"zset,omitempty"`
+	Timestamp int64                 `json:"timestamp"`
+	MsgID     string                `json:"msg_id"`
+
+	zindex *skipList // ordered index over ZSet, rebuilt when decoded
+}
+
+// kind returns the value type, treating an empty Type as a string
+func (v Value) kind() string {
+	if v.Type == "" {
+		return TypeString
+	}
+	return v.Type
 }
 
 type StoreSnapshot struct {
-	Data map[string]Value `json:"data"`
+	Data       map[string]Value `json:"data"`
+	Tombstones map[string]Value `json:"tombstones,omitempty"`
 }
 
 func New() *Store {
 	return &Store{
 		data:          make(map[string]Value),
 		lastSeenMsgID: make(map[string]bool),
+		listWaiters:   make(map[string]map[chan struct{}]bool),
+		watchers:      make(map[int]func(Event)),
+		changes:       newChangeLog(DefaultChangeLogRetention),
+
+		tombstones:         make(map[string]Value),
+		tombstoneRetention: DefaultTombstoneRetention,
 	}
 }
 
@@ -44,6 +91,7 @@ func (s *Store) Set(key, value string, timestamp int64, msgID string) {
 			Timestamp: timestamp,
 			MsgID:     msgID,
 		}
+		s.notify(key, OpSet, timestamp, msgID, value)
 	}
 }
 
@@ -51,7 +99,22 @@ func (s *Store) Get(key string) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	val, ok := s.data[key]
-	return val.Data, ok
+	if !ok || val.kind() != TypeString {
+		return "", false
+	}
+	return val.Data, true
+}
+
+// Type returns the type of the value stored at key, or TypeNone
+func (s *Store) Type(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	val, ok := s.data[key]
+	if !ok {
+		return TypeNone
+	}
+	return val.kind()
 }
 
 func (s *Store) Del(key string, timestamp int64, msgID string) {
@@ -66,6 +129,7 @@ func (s *Store) Del(key string, timestamp int64, msgID string) {
 	current, exists := s.data[key]
 	if exists && timestamp > current.Timestamp {
 		delete(s.data, key)
+		s.notify(key, OpDel, timestamp, msgID, "")
 	}
 }
 
@@ -82,6 +146,13 @@ func (s *Store) GetSnapshot() ([]byte, error) {
 	for k, v := range s.data {
 		snapshot.Data[k] = v
 	}
+	// Peers need the tombstones of deleted keys as much as the live ones
+	if len(s.tombstones) > 0 {
+		snapshot.Tombstones = make(map[string]Value, len(s.tombstones))
+		for k, v := range s.tombstones {
+			snapshot.Tombstones[k] = v
+		}
+	}
 
 	return json.Marshal(snapshot)
 }
@@ -98,19 +169,56 @@ func (s *Store) ApplySnapshot(data []byte) error {
 
 	// Merge data, keeping newer timestamps
 	for key, incomingValue := range snapshot.Data {
-		current, exists := s.data[key]
-		if !exists || incomingValue.Timestamp > current.Timestamp {
-			s.data[key] = incomingValue
-			// Mark message as seen to prevent duplicates
-			if incomingValue.MsgID != "" {
-				s.lastSeenMsgID[incomingValue.MsgID] = true
-			}
-		}
+		s.applyValue(key, incomingValue)
+	}
+	for key, incomingValue := range snapshot.Tombstones {
+		s.applyValue(key, incomingValue)
 	}
 
 	return nil
 }
 
+// applyValue merges one value of a snapshot. Must be called with s.mu held.
+func (s *Store) applyValue(key string, incomingValue Value) {
+	current, exists := s.data[key]
+	live := exists
+	if !exists && (incomingValue.kind() == TypeHash || incomingValue.kind() == TypeZSet) {
+		current, exists = s.tombstones[key]
+	}
+	if exists && current.kind() == TypeHash && incomingValue.kind() == TypeHash {
+		s.mergeHash(key, current, incomingValue)
+		return
+	}
+	if exists && current.kind() == TypeZSet && incomingValue.kind() == TypeZSet {
+		s.mergeZSet(key, current, incomingValue)
+		return
+	}
+	if !exists || incomingValue.Timestamp > current.Timestamp {
+		// Mark message as seen to prevent duplicates
+		if incomingValue.MsgID != "" {
+			s.lastSeenMsgID[incomingValue.MsgID] = true
+		}
+		if isDead(incomingValue) {
+			// A deleted hash or sorted set newer than what we have
+			s.bury(key, incomingValue)
+			if live {
+				s.notify(key, OpDel, incomingValue.Timestamp, incomingValue.MsgID, "")
+			}
+			return
+		}
+		if incomingValue.kind() == TypeZSet {
+			incomingValue.zindex = buildZSetIndex(incomingValue.ZSet)
+		}
+		s.data[key] = incomingValue
+		delete(s.tombstones, key)
+		if incomingValue.kind() == TypeList {
+			s.notifyListWaiters(key)
+		}
+		// The whole value was replaced, so it is all part of the change
+		s.notify(key, OpSet, incomingValue.Timestamp, incomingValue.MsgID, s.encodeForLog(key))
+	}
+}
+
 // GetAllKeys returns all keys in the store
 func (s *Store) GetAllKeys() []string {
 	s.mu.RLock()
@@ -0,0 +1,63 @@
+package store
+
+import "time"
+
+// DefaultTombstoneRetention is how long a hash or sorted set whose every
+// field or member has been deleted is remembered. Until then its tombstones
+// keep older writes from peers from bringing them back; a peer that has
+// been away for longer may still do so when it syncs.
+const DefaultTombstoneRetention = 24 * time.Hour
+
+// bury removes key and keeps its value, whose fields or members are all
+// tombstones, for the retention. Must be called with s.mu held.
+func (s *Store) bury(key string, v Value) {
+	if v.kind() == TypeZSet && v.zindex == nil {
+		v.zindex = newSkipList()
+	}
+	delete(s.data, key)
+	s.tombstones[key] = v
+	s.pruneTombstones(v.Timestamp)
+}
+
+// pruneTombstones drops the tombstones older than the retention, at most
+// once a minute. now is the timestamp of the latest write. Must be called
+// with s.mu held.
+func (s *Store) pruneTombstones(now int64) {
+	if now < s.tombstonesPruned+int64(time.Minute) {
+		return
+	}
+	s.tombstonesPruned = now
+
+	cutoff := now - int64(s.tombstoneRetention)
+	for key, v := range s.tombstones {
+		if v.Timestamp < cutoff {
+			delete(s.tombstones, key)
+		}
+	}
+}
+
+// SetTombstoneRetention sets how long deleted hashes and sorted sets keep
+// their tombstones
+func (s *Store) SetTombstoneRetention(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tombstoneRetention = d
+	s.tombstonesPruned = 0
+}
+
+// isDead reports whether v is a hash or sorted set with nothing but
+// tombstones left
+func isDead(v Value) bool {
+	switch v.kind() {
+	case TypeHash:
+		return !hasLiveFields(v)
+	case TypeZSet:
+		for _, m := range v.ZSet {
+			if !m.Deleted {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package store
+
+import "unsafe"
+
+// Usage is an estimate of how much the store holds
+type Usage struct {
+	Keys       int            // keys in the store
+	Types      map[string]int // keys by type (TypeString, TypeHash, ...)
+	DedupIDs   int            // msg-ids remembered to drop duplicate writes
+	DataBytes  int            // keys and values, with their metadata
+	DedupBytes int            // the msg-id history
+}
+
+// Per-entry overhead of the maps and slices holding the data, roughly what
+// the Go runtime spends on a bucket slot and the string headers
+const (
+	mapEntryOverhead = 48
+	valueOverhead    = int(unsafe.Sizeof(Value{}))
+	fieldOverhead    = int(unsafe.Sizeof(HashField{}))
+	itemOverhead     = int(unsafe.Sizeof(ListItem{}))
+	memberOverhead   = int(unsafe.Sizeof(ZSetMember{}))
+)
+
+// Usage walks the store and estimates the memory it uses. It is O(n) in
+// the number of values, so it is meant for monitoring, not hot paths.
+func (s *Store) Usage() Usage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := Usage{Keys: len(s.data), Types: make(map[string]int), DedupIDs: len(s.lastSeenMsgID)}
+	for key, v := range s.data {
+		u.Types[v.kind()]++
+		u.DataBytes += mapEntryOverhead + len(key) + valueSize(v)
+	}
+	for id := range s.lastSeenMsgID {
+		u.DedupBytes += mapEntryOverhead + len(id)
+	}
+	return u
+}
+
+// valueSize - estimated size of v
+func valueSize(v Value) int {
+	n := valueOverhead + len(v.Type) + len(v.Data) + len(v.MsgID)
+	for field, f := range v.Hash {
+		n += mapEntryOverhead + len(field) + fieldOverhead + len(f.Data) + len(f.MsgID)
+	}
+	for _, item := range v.List {
+		n += itemOverhead + len(item.ID) + len(item.Data)
+	}
+	for member, m := range v.ZSet {
+		// Members are indexed twice: in the map and in the skip list
+		n += 2*(mapEntryOverhead+len(member)) + memberOverhead + len(m.MsgID)
+	}
+	return n
+}
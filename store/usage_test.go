@@ -0,0 +1,33 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	s := New()
+	empty := s.Usage()
+	if empty.Keys != 0 || empty.DataBytes != 0 || empty.DedupBytes != 0 {
+		t.Errorf("Expected an empty store to use nothing, got %+v", empty)
+	}
+
+	s.Set("small", "x", 1, "msg-1")
+	small := s.Usage()
+	s.Set("big", strings.Repeat("x", 10000), 2, "msg-2")
+	s.HSet("hash", map[string]string{"field": "value"}, 3, "msg-3")
+	u := s.Usage()
+
+	if u.Keys != 3 || u.DedupIDs != 3 {
+		t.Errorf("Expected 3 keys and 3 msg-ids, got %+v", u)
+	}
+	if u.Types[TypeString] != 2 || u.Types[TypeHash] != 1 {
+		t.Errorf("Expected 2 strings and 1 hash, got %v", u.Types)
+	}
+	if u.DataBytes-small.DataBytes < 10000 {
+		t.Errorf("Expected the big value to be counted, got %d then %d bytes", small.DataBytes, u.DataBytes)
+	}
+	if u.DedupBytes <= small.DedupBytes {
+		t.Errorf("Expected the msg-id history to grow, got %d then %d bytes", small.DedupBytes, u.DedupBytes)
+	}
+}
@@ -0,0 +1,381 @@
+package store
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrNotFloat is returned when a score is NaN or infinite, which neither
+// orders nor encodes in snapshots
+var ErrNotFloat = errors.New("score is not a valid float")
+
+// validScore reports whether score can be stored
+func validScore(score float64) bool {
+	return !math.IsNaN(score) && !math.IsInf(score, 0)
+}
+
+// ZSetMember is a single sorted set member. Like hash fields, members carry
+// their own timestamp so concurrent updates to different members merge
+// independently, and removed members are kept as tombstones.
+type ZSetMember struct {
+	Score     float64 `json:"score"`
+	Timestamp int64   `json:"timestamp"`
+	MsgID     string  `json:"msg_id"`
+	Deleted   bool    `json:"deleted,omitempty"`
+}
+
+// ScoredMember is a member returned by the range queries
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// ScoreBound is one end of a score range
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+// Unbounded score ranges
+var (
+	MinScore = ScoreBound{Value: math.Inf(-1)}
+	MaxScore = ScoreBound{Value: math.Inf(1)}
+)
+
+// lessOrEqual reports whether score lies above the bound used as a minimum
+func (b ScoreBound) lessOrEqual(score float64) bool {
+	if b.Exclusive {
+		return b.Value < score
+	}
+	return b.Value <= score
+}
+
+// greaterOrEqual reports whether score lies below the bound used as a maximum
+func (b ScoreBound) greaterOrEqual(score float64) bool {
+	if b.Exclusive {
+		return score < b.Value
+	}
+	return score <= b.Value
+}
+
+// ZAdd sets the scores of members in the sorted set stored at key and
+// returns how many members were newly added
+func (s *Store) ZAdd(key string, members map[string]float64, timestamp int64, msgID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastSeenMsgID[msgID] {
+		return 0, nil
+	}
+
+	current, exists := s.data[key]
+	if exists && current.kind() != TypeZSet {
+		return 0, ErrWrongType
+	}
+	for _, score := range members {
+		if !validScore(score) {
+			return 0, ErrNotFloat
+		}
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	if !exists {
+		current = s.newZSet(key)
+	}
+
+	added, changes := 0, make(map[string]*float64)
+	for member, score := range members {
+		existing, ok := current.ZSet[member]
+		if ok && timestamp <= existing.Timestamp {
+			continue
+		}
+		if !ok || existing.Deleted {
+			added++
+		}
+		changes[member] = &score
+		current.setZSetMember(member, ZSetMember{Score: score, Timestamp: timestamp, MsgID: msgID})
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeZSet(key, current)
+	if len(changes) > 0 {
+		s.notify(key, OpZAdd, timestamp, msgID, encodeChange(changes))
+	}
+
+	return added, nil
+}
+
+// ZRem removes members from the sorted set stored at key and returns how
+// many live members were removed
+func (s *Store) ZRem(key string, members []string, timestamp int64, msgID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastSeenMsgID[msgID] {
+		return 0, nil
+	}
+
+	current, exists := s.data[key]
+	if !exists {
+		s.lastSeenMsgID[msgID] = true
+		return 0, nil
+	}
+	if current.kind() != TypeZSet {
+		return 0, ErrWrongType
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	removed, changes := 0, make(map[string]*float64)
+	for _, member := range members {
+		existing, ok := current.ZSet[member]
+		if ok && timestamp <= existing.Timestamp {
+			continue
+		}
+		if ok && !existing.Deleted {
+			removed++
+			changes[member] = nil
+		}
+		current.setZSetMember(member, ZSetMember{Timestamp: timestamp, MsgID: msgID, Deleted: true})
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeZSet(key, current)
+	if removed > 0 {
+		s.notify(key, OpZRem, timestamp, msgID, encodeChange(changes))
+	}
+
+	return removed, nil
+}
+
+// ZIncrBy adds delta to the score of member and returns the new score.
+// Missing members start at zero.
+func (s *Store) ZIncrBy(key, member string, delta float64, timestamp int64, msgID string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.data[key]
+	if exists && current.kind() != TypeZSet {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		current = s.newZSet(key)
+	}
+
+	var score float64
+	existing, ok := current.ZSet[member]
+	if ok && !existing.Deleted {
+		score = existing.Score
+	}
+
+	if s.lastSeenMsgID[msgID] {
+		return score, nil
+	}
+	if !validScore(score + delta) {
+		return 0, ErrNotFloat
+	}
+	s.lastSeenMsgID[msgID] = true
+
+	score += delta
+	changes := make(map[string]*float64)
+	if !ok || timestamp > existing.Timestamp {
+		current.setZSetMember(member, ZSetMember{Score: score, Timestamp: timestamp, MsgID: msgID})
+		changes[member] = &score
+	}
+
+	if timestamp > current.Timestamp {
+		current.Timestamp = timestamp
+		current.MsgID = msgID
+	}
+	s.storeZSet(key, current)
+	if len(changes) > 0 {
+		s.notify(key, OpZAdd, timestamp, msgID, encodeChange(changes))
+	}
+
+	return score, nil
+}
+
+// ZScore returns the score of member
+func (s *Store) ZScore(key, member string) (float64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, exists := s.data[key]
+	if !exists {
+		return 0, false, nil
+	}
+	if current.kind() != TypeZSet {
+		return 0, false, ErrWrongType
+	}
+
+	m, ok := current.ZSet[member]
+	if !ok || m.Deleted {
+		return 0, false, nil
+	}
+	return m.Score, true, nil
+}
+
+// ZRank returns the 0-based rank of member, ordered from the lowest score
+func (s *Store) ZRank(key, member string) (int, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, exists := s.data[key]
+	if !exists {
+		return 0, false, nil
+	}
+	if current.kind() != TypeZSet {
+		return 0, false, ErrWrongType
+	}
+
+	m, ok := current.ZSet[member]
+	if !ok || m.Deleted {
+		return 0, false, nil
+	}
+	return current.zindex.rank(member, m.Score), true, nil
+}
+
+// ZRange returns the members between ranks start and stop inclusive.
+// Negative ranks count from the highest score.
+func (s *Store) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []ScoredMember{}
+
+	current, exists := s.data[key]
+	if !exists {
+		return result, nil
+	}
+	if current.kind() != TypeZSet {
+		return nil, ErrWrongType
+	}
+
+	n := current.zindex.length
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return result, nil
+	}
+
+	x := current.zindex.byRank(start)
+	for i := start; i <= stop && x != nil; i++ {
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		x = x.level[0].forward
+	}
+	return result, nil
+}
+
+// ZRangeByScore returns the members whose score lies between min and max,
+// skipping offset members and returning at most count (all if count < 0)
+func (s *Store) ZRangeByScore(key string, min, max ScoreBound, offset, count int) ([]ScoredMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []ScoredMember{}
+
+	current, exists := s.data[key]
+	if !exists {
+		return result, nil
+	}
+	if current.kind() != TypeZSet {
+		return nil, ErrWrongType
+	}
+
+	x := current.zindex.firstInRange(min, max)
+	for ; x != nil && offset > 0; offset-- {
+		x = x.level[0].forward
+	}
+	for ; x != nil && count != 0 && max.greaterOrEqual(x.score); x = x.level[0].forward {
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		count--
+	}
+	return result, nil
+}
+
+// setZSetMember updates a member and keeps the skip list index in step
+func (v Value) setZSetMember(member string, m ZSetMember) {
+	if old, ok := v.ZSet[member]; ok && !old.Deleted {
+		v.zindex.delete(member, old.Score)
+	}
+	if !m.Deleted {
+		v.zindex.insert(member, m.Score)
+	}
+	v.ZSet[member] = m
+}
+
+// mergeZSet merges an incoming sorted set into the current one member by
+// member. Must be called with s.mu held.
+func (s *Store) mergeZSet(key string, current, incoming Value) {
+	changes := make(map[string]*float64)
+	for member, m := range incoming.ZSet {
+		existing, ok := current.ZSet[member]
+		if !ok || m.Timestamp > existing.Timestamp {
+			current.setZSetMember(member, m)
+			if !m.Deleted {
+				changes[member] = &m.Score
+			} else if ok && !existing.Deleted {
+				changes[member] = nil
+			}
+			if m.MsgID != "" {
+				s.lastSeenMsgID[m.MsgID] = true
+			}
+		}
+	}
+
+	if incoming.Timestamp > current.Timestamp {
+		current.Timestamp = incoming.Timestamp
+		current.MsgID = incoming.MsgID
+	}
+	s.storeZSet(key, current)
+	if len(changes) > 0 {
+		s.notify(key, OpZAdd, incoming.Timestamp, incoming.MsgID, encodeChange(changes))
+	}
+}
+
+// buildZSetIndex rebuilds the skip list for a sorted set decoded from a snapshot
+func buildZSetIndex(members map[string]ZSetMember) *skipList {
+	index := newSkipList()
+	for member, m := range members {
+		if !m.Deleted {
+			index.insert(member, m.Score)
+		}
+	}
+	return index
+}
+
+// newZSet returns the sorted set to write to a missing key: the tombstones
+// left by its removed members, if any, or an empty one. Must be called with
+// s.mu held.
+func (s *Store) newZSet(key string) Value {
+	if v, ok := s.tombstones[key]; ok && v.kind() == TypeZSet {
+		return v
+	}
+	return Value{Type: TypeZSet, ZSet: make(map[string]ZSetMember), zindex: newSkipList()}
+}
+
+// storeZSet writes a sorted set back. Once it is empty the key is dropped,
+// but its tombstones are kept for a while. Must be called with s.mu held.
+func (s *Store) storeZSet(key string, v Value) {
+	if v.zindex.length > 0 {
+		s.data[key] = v
+		delete(s.tombstones, key)
+		return
+	}
+	s.bury(key, v)
+}
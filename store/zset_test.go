@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestZSetBasicOperations(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	added, err := s.ZAdd("board", map[string]float64{"alice": 30, "bob": 10, "carol": 20}, timestamp, "msg-1")
+	if err != nil || added != 3 {
+		t.Fatalf("Expected 3 added members, got %d (err=%v)", added, err)
+	}
+
+	members, _ := s.ZRange("board", 0, -1)
+	if len(members) != 3 || members[0].Member != "bob" || members[2].Member != "alice" {
+		t.Errorf("Unexpected ZRange order: %v", members)
+	}
+
+	rank, ok, _ := s.ZRank("board", "carol")
+	if !ok || rank != 1 {
+		t.Errorf("Expected carol at rank 1, got %d", rank)
+	}
+
+	score, _ := s.ZIncrBy("board", "bob", 25, timestamp+1, "msg-2")
+	if score != 35 {
+		t.Errorf("Expected score 35, got %v", score)
+	}
+
+	rank, _, _ = s.ZRank("board", "bob")
+	if rank != 2 {
+		t.Errorf("Expected bob to move to rank 2, got %d", rank)
+	}
+
+	removed, _ := s.ZRem("board", []string{"carol", "nobody"}, timestamp+2, "msg-3")
+	if removed != 1 {
+		t.Errorf("Expected 1 removed member, got %d", removed)
+	}
+	if _, ok, _ := s.ZScore("board", "carol"); ok {
+		t.Error("Expected carol to be removed")
+	}
+
+	s.Set("plain", "value", timestamp, "msg-4")
+	if _, err := s.ZAdd("plain", map[string]float64{"x": 1}, timestamp+1, "msg-5"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestZSetRangeByScore(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	s.ZAdd("events", map[string]float64{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}, timestamp, "msg-1")
+
+	members, _ := s.ZRangeByScore("events", ScoreBound{Value: 2}, ScoreBound{Value: 5, Exclusive: true}, 0, -1)
+	if len(members) != 3 || members[0].Member != "b" || members[2].Member != "d" {
+		t.Errorf("Expected [b c d], got %v", members)
+	}
+
+	members, _ = s.ZRangeByScore("events", MinScore, MaxScore, 1, 2)
+	if len(members) != 2 || members[0].Member != "b" || members[1].Member != "c" {
+		t.Errorf("Expected LIMIT 1 2 to return [b c], got %v", members)
+	}
+}
+
+func TestZSetSnapshotMerge(t *testing.T) {
+	s1 := New()
+	s2 := New()
+	timestamp := time.Now().UnixNano()
+
+	s1.ZAdd("board", map[string]float64{"alice": 1}, timestamp, "msg-1")
+	s2.ZAdd("board", map[string]float64{"bob": 2}, timestamp+1, "msg-2")
+
+	snapshot, err := s2.GetSnapshot()
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+	if err := s1.ApplySnapshot(snapshot); err != nil {
+		t.Fatalf("Failed to apply snapshot: %v", err)
+	}
+
+	members, _ := s1.ZRange("board", 0, -1)
+	if len(members) != 2 || members[0].Member != "alice" || members[1].Member != "bob" {
+		t.Errorf("Expected merged [alice bob], got %v", members)
+	}
+
+	// A node without the key rebuilds the index from the snapshot
+	s3 := New()
+	s3.ApplySnapshot(snapshot)
+	if rank, ok, _ := s3.ZRank("board", "bob"); !ok || rank != 0 {
+		t.Errorf("Expected bob at rank 0 after snapshot, got %d", rank)
+	}
+}
+
+func TestZSetRejectsNonFiniteScores(t *testing.T) {
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	for _, score := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := s.ZAdd("z", map[string]float64{"m": score}, timestamp, "msg-1"); !errors.Is(err, ErrNotFloat) {
+			t.Errorf("Expected ErrNotFloat for %v, got %v", score, err)
+		}
+	}
+
+	s.ZAdd("z", map[string]float64{"m": math.MaxFloat64}, timestamp, "msg-2")
+	if _, err := s.ZIncrBy("z", "m", math.MaxFloat64, timestamp+1, "msg-3"); !errors.Is(err, ErrNotFloat) {
+		t.Errorf("Expected ErrNotFloat when ZIncrBy overflows, got %v", err)
+	}
+
+	if _, err := s.GetSnapshot(); err != nil {
+		t.Errorf("Expected the snapshot to encode, got %v", err)
+	}
+	members, _ := s.ZRange("z", 0, -1)
+	if len(members) != 1 || members[0].Score != math.MaxFloat64 {
+		t.Errorf("Expected one member with its score unchanged, got %v", members)
+	}
+}
+
+func TestZSetTombstonesOutliveKey(t *testing.T) {
+	peer := New()
+	s := New()
+	timestamp := time.Now().UnixNano()
+
+	peer.ZAdd("z", map[string]float64{"m": 1}, timestamp, "msg-1")
+	stale, _ := peer.GetSnapshot()
+
+	s.ZAdd("z", map[string]float64{"m": 2}, timestamp+1, "msg-2")
+	s.ZRem("z", []string{"m"}, timestamp+2, "msg-3")
+
+	// An older snapshot must not bring the removed member back
+	if err := s.ApplySnapshot(stale); err != nil {
+		t.Fatalf("Failed to apply snapshot: %v", err)
+	}
+	if s.Type("z") != TypeNone {
+		members, _ := s.ZRange("z", 0, -1)
+		t.Errorf("Removed member came back from an older snapshot: %v", members)
+	}
+
+	snapshot, _ := s.GetSnapshot()
+	peer.ApplySnapshot(snapshot)
+	if peer.Type("z") != TypeNone {
+		t.Errorf("Expected the peer to delete the sorted set, got type %s", peer.Type("z"))
+	}
+
+	// A newer write on the peer, which now only has tombstones, still wins
+	peer.ZAdd("z", map[string]float64{"m": 3}, timestamp+3, "msg-4")
+	snapshot, _ = peer.GetSnapshot()
+	s.ApplySnapshot(snapshot)
+	if score, ok, _ := s.ZScore("z", "m"); !ok || score != 3 {
+		t.Errorf("Expected m=3, got %v (found=%v)", score, ok)
+	}
+}